@@ -2,6 +2,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net"
 	"net/http"
@@ -10,28 +11,105 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/murar8/local-jwks-server/internal/authcode"
 	"github.com/murar8/local-jwks-server/internal/config"
 	"github.com/murar8/local-jwks-server/internal/handler"
+	"github.com/murar8/local-jwks-server/internal/keydir"
+	"github.com/murar8/local-jwks-server/internal/refresh"
+	"github.com/murar8/local-jwks-server/internal/revocation"
+	"github.com/murar8/local-jwks-server/internal/rotation"
 	"github.com/murar8/local-jwks-server/internal/token"
 )
 
-func createPrivateKey(cfg *config.JWK) (interface{}, error) {
+func createPrivateKeys(cfg *config.Key) ([]interface{}, error) {
+	if cfg.HMACSecret != "" {
+		log.Println("using HMAC secret from configuration")
+		return token.ParsePrivateKeys([]byte(cfg.HMACSecret), cfg.Alg)
+	}
+
 	keyFile, err := os.ReadFile(cfg.KeyFile)
 	if err != nil && !os.IsNotExist(err) {
 		return nil, err
 	}
 
-	var privateKey interface{}
-
 	if os.IsNotExist(err) {
-		log.Println("key file not found, generating a random key")
-		privateKey, err = token.GeneratePrivateKey(cfg.Alg, cfg.RsaKeySize)
-	} else {
-		log.Printf("using key from %s", cfg.KeyFile)
-		privateKey, err = token.ParsePrivateKey(keyFile, cfg.Alg)
+		var privateKey interface{}
+		if cfg.Seed != "" {
+			log.Println("key file not found, generating a key from the configured seed")
+		} else {
+			log.Println("key file not found, generating a random key")
+		}
+
+		privateKey, err = token.GeneratePrivateKey(cfg.Alg, cfg.RsaKeySize, token.WithSeed([]byte(cfg.Seed)))
+		if err != nil {
+			return nil, err
+		}
+
+		if cfg.Persist && cfg.KeyFile != "" {
+			log.Printf("saving generated key to %s", cfg.KeyFile)
+			if err = token.SavePrivateKey(cfg.KeyFile, privateKey); err != nil {
+				return nil, err
+			}
+		}
+
+		return []interface{}{privateKey}, nil
+	}
+
+	log.Printf("using key from %s", cfg.KeyFile)
+	return token.ParsePrivateKeys(keyFile, cfg.Alg, token.WithPassphrase([]byte(cfg.Passphrase)))
+}
+
+func attachCertificates(keys []jwk.Key, cfg *config.Key) error {
+	if cfg.CertFile != "" {
+		log.Printf("using certificate from %s", cfg.CertFile)
+
+		data, err := os.ReadFile(cfg.CertFile)
+		if err != nil {
+			return err
+		}
+
+		chain, err := token.ParseCertificateChain(data)
+		if err != nil {
+			return err
+		}
+
+		return token.AttachCertificateChain(keys, chain)
+	}
+
+	if cfg.SelfSignedCert {
+		for _, key := range keys {
+			if err := token.EnsureCertificate(key); err != nil {
+				return err
+			}
+		}
 	}
 
-	return privateKey, err
+	return nil
+}
+
+func createKeys(cfg *config.JWK) ([]jwk.Key, error) {
+	var keys []jwk.Key
+
+	for _, keyCfg := range cfg.AllKeys() {
+		privateKeys, err := createPrivateKeys(&keyCfg)
+		if err != nil {
+			return nil, err
+		}
+
+		fileKeys, err := token.NewKeys(privateKeys, &keyCfg)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = attachCertificates(fileKeys, &keyCfg); err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, fileKeys...)
+	}
+
+	return keys, nil
 }
 
 func createRouter() *chi.Mux {
@@ -46,7 +124,6 @@ func createRouter() *chi.Mux {
 		render.Render(w, r, res)
 	})
 
-	router.Use(middleware.AllowContentType("application/json"))
 	router.Use(middleware.Heartbeat("/health"))
 	router.Use(middleware.RequestID)
 	router.Use(middleware.Logger)
@@ -56,26 +133,109 @@ func createRouter() *chi.Mux {
 	return router
 }
 
+func registerRoutes(router chi.Router, tokenService token.Service, rotator *rotation.Rotator, cfg *config.Config) {
+	revocations := revocation.New()
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.AllowContentType("application/json"))
+
+		handlers := handler.New(tokenService, revocations, &cfg.JWK)
+		r.Get("/.well-known/jwks.json", handlers.HandleJWKS)
+		r.Post("/jwt/sign", handlers.HandleSign)
+		r.Post("/jwt/sign/{profile}", handlers.HandleSignProfile)
+		r.Post("/jwt/verify", handlers.HandleVerify)
+
+		discoveryHandlers := handler.NewDiscovery(tokenService, &cfg.JWK)
+		r.Get("/.well-known/openid-configuration", discoveryHandlers.HandleOpenIDConfiguration)
+		r.Get("/.well-known/oauth-authorization-server", discoveryHandlers.HandleAuthorizationServerMetadata)
+		r.Get("/.well-known/oauth-authorization-server/{tenant}", discoveryHandlers.HandleAuthorizationServerMetadata)
+
+		r.Group(func(r chi.Router) {
+			r.Use(handler.AdminAuth(cfg.Admin.Token))
+
+			adminHandlers := handler.NewAdmin(tokenService, rotator, &cfg.JWK)
+			r.Get("/admin/rotation", adminHandlers.HandleRotationStatus)
+			r.Get("/admin/keys", adminHandlers.HandleListKeys)
+			r.Post("/admin/keys", adminHandlers.HandleAddKey)
+			r.Post("/admin/keys/rotate", adminHandlers.HandleRotateKey)
+			r.Delete("/admin/keys/{kid}", adminHandlers.HandleDeleteKey)
+			r.With(handler.RequireAdminToken(cfg.Admin.Token)).Get("/admin/keys/{kid}/secret", adminHandlers.HandleGetSecret)
+		})
+	})
+
+	// OAuth endpoints accept form-encoded requests as required by RFC 6749.
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.AllowContentType("application/x-www-form-urlencoded"))
+
+		codes := authcode.New(authcode.DefaultTTL)
+		refreshTokens := refresh.New(cfg.OAuth.RefreshTokenTTL)
+		oauthHandlers := handler.NewOAuth(tokenService, revocations, codes, refreshTokens, cfg)
+
+		// Tenant routes sign tokens with the issuer of the tenant, see the
+		// authorization server metadata.
+		for _, prefix := range []string{"", "/{tenant}"} {
+			r.Get(prefix+"/authorize", oauthHandlers.HandleAuthorize)
+			r.Post(prefix+"/authorize", oauthHandlers.HandleAuthorizeLogin)
+			r.Post(prefix+"/oauth/token", oauthHandlers.HandleToken)
+			r.Post(prefix+"/oauth/introspect", oauthHandlers.HandleIntrospect)
+			r.Post(prefix+"/oauth/revoke", oauthHandlers.HandleRevoke)
+			r.Get(prefix+"/userinfo", oauthHandlers.HandleUserInfo)
+			r.Post(prefix+"/userinfo", oauthHandlers.HandleUserInfo)
+		}
+	})
+}
+
 func main() {
 	cfg, err := config.New()
 	if err != nil {
 		log.Fatalf("failed to initialize config: %s", err)
 	}
 
-	privateKey, err := createPrivateKey(&cfg.JWK)
+	keys, err := createKeys(&cfg.JWK)
 	if err != nil {
-		log.Fatalf("failed to initialize private key: %s", err)
+		log.Fatalf("failed to initialize private keys: %s", err)
 	}
 
-	tokenService, err := token.FromRawKey(privateKey, &cfg.JWK)
+	var watcher *keydir.Watcher
+	if cfg.JWK.KeysDir != "" {
+		watcher = keydir.New(&cfg.JWK)
+
+		var dirKeys []jwk.Key
+		if dirKeys, err = watcher.Load(); err != nil {
+			log.Fatalf("failed to load keys directory: %s", err)
+		}
+
+		log.Printf("using %d keys from %s", len(dirKeys), cfg.JWK.KeysDir)
+		keys = append(keys, dirKeys...)
+	}
+
+	tokenService, err := token.New(keys, &cfg.JWK)
 	if err != nil {
 		log.Fatalf("failed to initialize token service: %s", err)
 	}
 
+	if watcher != nil {
+		go func() {
+			if runErr := watcher.Run(context.Background(), tokenService); runErr != nil {
+				log.Fatalf("failed to watch keys directory: %s", runErr)
+			}
+		}()
+	}
+
+	rotator := rotation.New(tokenService, &cfg.Rotation, cfg.JWK.RsaKeySize)
+	go func() {
+		if runErr := rotator.Run(context.Background()); runErr != nil {
+			log.Fatalf("failed to rotate key: %s", runErr)
+		}
+	}()
+
+	if cfg.Admin.Token == "" {
+		log.Println("admin endpoints are not authenticated, set ADMIN_TOKEN to protect them")
+	}
+
 	router := createRouter()
-	handlers := handler.New(tokenService)
-	router.Get("/.well-known/jwks.json", handlers.HandleJWKS)
-	router.Post("/jwt/sign", handlers.HandleSign)
+
+	registerRoutes(router, tokenService, rotator, cfg)
 
 	addr := net.TCPAddr{IP: cfg.Server.Addr, Port: cfg.Server.Port}
 	log.Printf("listening on %s", addr.String())
@@ -0,0 +1,128 @@
+package authcode
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultTTL is the lifetime of authorization codes, long enough for slow
+// browser automation while staying within the RFC 6749 recommendation.
+const DefaultTTL = 5 * time.Minute
+
+// PKCE code challenge methods, see RFC 7636.
+const (
+	ChallengeS256  = "S256"
+	ChallengePlain = "plain"
+)
+
+var (
+	// ErrMissingVerifier is returned when a code issued with a PKCE challenge
+	// is redeemed without a code verifier.
+	ErrMissingVerifier = errors.New("missing code verifier")
+
+	// ErrInvalidVerifier is returned when the code verifier does not match the
+	// code challenge, or when a verifier is provided for a code issued without
+	// a challenge.
+	ErrInvalidVerifier = errors.New("invalid code verifier")
+)
+
+// Grant is the authorization bound to a code.
+type Grant struct {
+	ClientID            string
+	RedirectURI         string
+	Scopes              []string
+	Claims              map[string]interface{}
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	AuthTime            time.Time
+
+	expiresAt time.Time
+}
+
+// IsSupportedChallengeMethod reports whether the PKCE method is supported.
+func IsSupportedChallengeMethod(method string) bool {
+	return method == ChallengeS256 || method == ChallengePlain
+}
+
+// VerifyChallenge checks the PKCE code verifier against the code challenge of
+// the grant.
+func (g *Grant) VerifyChallenge(verifier string) error {
+	if g.CodeChallenge == "" {
+		if verifier != "" {
+			return ErrInvalidVerifier
+		}
+		return nil
+	}
+
+	if verifier == "" {
+		return ErrMissingVerifier
+	}
+
+	expected := verifier
+	if g.CodeChallengeMethod == ChallengeS256 {
+		sum := sha256.Sum256([]byte(verifier))
+		expected = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(g.CodeChallenge)) != 1 {
+		return ErrInvalidVerifier
+	}
+
+	return nil
+}
+
+// Store holds the authorization codes that have not been redeemed yet.
+type Store struct {
+	mu     sync.Mutex
+	ttl    time.Duration
+	grants map[string]Grant
+}
+
+func New(ttl time.Duration) *Store {
+	return &Store{ttl: ttl, grants: map[string]Grant{}}
+}
+
+// Issue returns a new authorization code for the grant.
+func (s *Store) Issue(grant Grant) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for code, g := range s.grants {
+		if now.After(g.expiresAt) {
+			delete(s.grants, code)
+		}
+	}
+
+	code := rand.Text()
+	grant.expiresAt = now.Add(s.ttl)
+	s.grants[code] = grant
+
+	return code
+}
+
+// Redeem returns the grant of a code. Codes can only be redeemed once, and
+// expired codes are rejected.
+func (s *Store) Redeem(code string) (Grant, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	grant, exists := s.grants[code]
+	if !exists {
+		return Grant{}, false
+	}
+
+	delete(s.grants, code)
+
+	if time.Now().After(grant.expiresAt) {
+		return Grant{}, false
+	}
+
+	return grant, true
+}
@@ -0,0 +1,75 @@
+package authcode_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/murar8/local-jwks-server/internal/authcode"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	t.Run("redeems a code only once", func(t *testing.T) {
+		t.Parallel()
+
+		s := authcode.New(time.Minute)
+		code := s.Issue(authcode.Grant{ClientID: "client"})
+
+		grant, ok := s.Redeem(code)
+		require.True(t, ok)
+		assert.Equal(t, "client", grant.ClientID)
+
+		_, ok = s.Redeem(code)
+		assert.False(t, ok)
+	})
+
+	t.Run("rejects expired codes", func(t *testing.T) {
+		t.Parallel()
+
+		s := authcode.New(-time.Second)
+		code := s.Issue(authcode.Grant{ClientID: "client"})
+
+		_, ok := s.Redeem(code)
+		assert.False(t, ok)
+	})
+
+	t.Run("rejects unknown codes", func(t *testing.T) {
+		t.Parallel()
+
+		_, ok := authcode.New(time.Minute).Redeem("unknown")
+		assert.False(t, ok)
+	})
+}
+
+func TestVerifyChallenge(t *testing.T) {
+	t.Parallel()
+
+	// Example from RFC 7636 appendix B.
+	const verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	const challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	cases := []struct {
+		name     string
+		grant    authcode.Grant
+		verifier string
+		err      error
+	}{
+		{"accepts an S256 verifier", authcode.Grant{CodeChallenge: challenge, CodeChallengeMethod: "S256"}, verifier, nil},
+		{"accepts a plain verifier", authcode.Grant{CodeChallenge: verifier, CodeChallengeMethod: "plain"}, verifier, nil},
+		{"accepts codes without challenge", authcode.Grant{}, "", nil},
+		{"rejects a wrong verifier", authcode.Grant{CodeChallenge: challenge, CodeChallengeMethod: "S256"}, "wrong", authcode.ErrInvalidVerifier},
+		{"rejects a missing verifier", authcode.Grant{CodeChallenge: challenge, CodeChallengeMethod: "S256"}, "", authcode.ErrMissingVerifier},
+		{"rejects an unexpected verifier", authcode.Grant{}, verifier, authcode.ErrInvalidVerifier},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.ErrorIs(t, c.grant.VerifyChallenge(c.verifier), c.err)
+		})
+	}
+}
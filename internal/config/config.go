@@ -1,8 +1,12 @@
 package config
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/caarlos0/env/v9"
@@ -10,12 +14,219 @@ import (
 	"github.com/lestrrat-go/jwx/v2/jwk"
 )
 
+var (
+	// ErrInvalidKeys is returned when the additional keys file is invalid.
+	ErrInvalidKeys = errors.New("invalid keys file")
+
+	// ErrInvalidProfiles is returned when the profiles file is invalid.
+	ErrInvalidProfiles = errors.New("invalid profiles file")
+
+	// ErrInvalidClients is returned when the OAuth clients file is invalid.
+	ErrInvalidClients = errors.New("invalid clients file")
+
+	// ErrInvalidUsers is returned when the OAuth users file is invalid.
+	ErrInvalidUsers = errors.New("invalid users file")
+)
+
+// Key holds the configuration of a single signing key.
+type Key struct {
+	Alg        jwa.SignatureAlgorithm `json:"alg"`
+	KeyID      string                 `json:"kid"`
+	KeyFile    string                 `json:"key_file"`
+	KeyOps     jwk.KeyOperationList   `json:"key_ops"`
+	RsaKeySize int                    `json:"rsa_key_size"`
+	HMACSecret string                 `json:"hmac_secret"`
+
+	// Passphrase decrypts an encrypted KeyFile. It is read from
+	// passphrase_file when set.
+	Passphrase     string `json:"passphrase"`
+	PassphraseFile string `json:"passphrase_file"`
+
+	// Persist saves a generated key to KeyFile so that it is reused on the
+	// next start.
+	Persist bool `json:"persist"`
+
+	// Seed makes the generated key deterministic.
+	Seed string `json:"seed"`
+
+	// CertFile holds the PEM certificate chain of the key. A self-signed
+	// certificate is generated when SelfSignedCert is set instead.
+	CertFile       string `json:"cert_file"`
+	SelfSignedCert bool   `json:"self_signed_cert"`
+}
+
 type JWK struct {
-	Alg             jwa.SignatureAlgorithm `env:"JWK_ALG,notEmpty"     envDefault:"RS256"`
-	RsaKeySize      int                    `env:"JWK_RSA_KEY_SIZE"     envDefault:"2048"`
-	KeyFile         string                 `env:"JWK_KEY_FILE"         envDefault:"/etc/local-jwks-server/key.pem"`
-	KeyOps          jwk.KeyOperationList   `env:"JWK_KEY_OPS"`
-	FlattenAudience bool                   `env:"JWK_FLATTEN_AUDIENCE" envDefault:"false"`
+	Alg               jwa.SignatureAlgorithm `env:"JWK_ALG,notEmpty"      envDefault:"RS256"`
+	RsaKeySize        int                    `env:"JWK_RSA_KEY_SIZE"      envDefault:"2048"`
+	KeyFile           string                 `env:"JWK_KEY_FILE"          envDefault:"/etc/local-jwks-server/key.pem"`
+	KeyID             string                 `env:"JWK_KEY_ID"`
+	HMACSecret        string                 `env:"JWK_HMAC_SECRET"`
+	KeyOps            jwk.KeyOperationList   `env:"JWK_KEY_OPS"`
+	FlattenAudience   bool                   `env:"JWK_FLATTEN_AUDIENCE"  envDefault:"false"`
+	KeysFile          string                 `env:"JWK_KEYS_FILE"`
+	DefaultKeyID      string                 `env:"JWK_DEFAULT_KEY_ID"`
+	KeyPassphrase     string                 `env:"JWK_KEY_PASSPHRASE"`
+	KeyPassphraseFile string                 `env:"JWK_KEY_PASSPHRASE_FILE"`
+	PersistKey        bool                   `env:"JWK_PERSIST_KEY"       envDefault:"false"`
+	Seed              string                 `env:"JWK_SEED"`
+	KeysDir           string                 `env:"JWK_KEYS_DIR"`
+	KeysDirInterval   time.Duration          `env:"JWK_KEYS_DIR_INTERVAL" envDefault:"2s"`
+	CertFile          string                 `env:"JWK_CERT_FILE"`
+	SelfSignedCert    bool                   `env:"JWK_SELF_SIGNED_CERT"  envDefault:"false"`
+
+	// Claims holds the default claims of signed tokens.
+	Claims Claims
+
+	// Profiles holds the token profiles loaded from ProfilesFile.
+	ProfilesFile string `env:"JWT_PROFILES_FILE"`
+	Profiles     map[string]Profile
+
+	// VerifySkew is the clock skew tolerated when verifying tokens.
+	VerifySkew time.Duration `env:"JWT_VERIFY_SKEW" envDefault:"0s"`
+
+	// Keys holds the additional keys loaded from KeysFile.
+	Keys []Key
+}
+
+// Claims holds the registered claims added to signed tokens unless the payload
+// already contains them. A zero TTL disables the expiration time.
+type Claims struct {
+	Issuer        string        `env:"JWT_ISSUER"`
+	Audience      []string      `env:"JWT_AUDIENCE"`
+	TTL           time.Duration `env:"JWT_TTL"      envDefault:"1h"`
+	NotBeforeSkew time.Duration `env:"JWT_NBF_SKEW" envDefault:"0s"`
+	JTI           bool          `env:"JWT_JTI"      envDefault:"true"`
+}
+
+// Profile is a named template for signed tokens. The claims are used as the
+// base payload, and the TTL, when set, overrides the default token lifetime.
+type Profile struct {
+	Claims  map[string]interface{} `json:"claims"`
+	Headers map[string]interface{} `json:"headers"`
+	KeyID   string                 `json:"kid"`
+	Alg     jwa.SignatureAlgorithm `json:"alg"`
+	TTL     *Duration              `json:"ttl"`
+}
+
+// Duration is a time.Duration decoded from a JSON string such as "15m".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("failed to parse duration: %w", err)
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("failed to parse duration: %w", err)
+	}
+
+	*d = Duration(parsed)
+
+	return nil
+}
+
+// PrimaryKey returns the configuration of the key defined by the JWK_*
+// environment variables.
+func (j *JWK) PrimaryKey() Key {
+	return Key{
+		Alg:            j.Alg,
+		KeyID:          j.KeyID,
+		KeyFile:        j.KeyFile,
+		KeyOps:         j.KeyOps,
+		RsaKeySize:     j.RsaKeySize,
+		HMACSecret:     j.HMACSecret,
+		Passphrase:     j.KeyPassphrase,
+		Persist:        j.PersistKey,
+		Seed:           j.Seed,
+		CertFile:       j.CertFile,
+		SelfSignedCert: j.SelfSignedCert,
+	}
+}
+
+// AllKeys returns the primary key followed by the additional keys. The
+// primary key is replaced by the keys directory when KeysDir is set.
+func (j *JWK) AllKeys() []Key {
+	if j.KeysDir != "" {
+		return append([]Key(nil), j.Keys...)
+	}
+
+	return append([]Key{j.PrimaryKey()}, j.Keys...)
+}
+
+type Rotation struct {
+	Interval    time.Duration `env:"JWK_ROTATION_INTERVAL"`
+	GracePeriod time.Duration `env:"JWK_ROTATION_GRACE_PERIOD" envDefault:"5m"`
+}
+
+// Client is an OAuth client registered with the server. Clients without a
+// secret are public clients.
+type Client struct {
+	ID           string   `json:"client_id"`
+	Secret       string   `json:"client_secret"`
+	Scopes       []string `json:"scopes"`
+	Audience     []string `json:"audience"`
+	RedirectURIs []string `json:"redirect_uris"`
+}
+
+// User is an identity that can sign in to the authorization endpoint, or
+// with the password grant if it has a username and password. Claims are added
+// to the tokens issued for the user.
+type User struct {
+	Subject  string                 `json:"sub"`
+	Username string                 `json:"username"`
+	Password string                 `json:"password"`
+	Claims   map[string]interface{} `json:"claims"`
+}
+
+type OAuth struct {
+	ClientsFile          string `env:"OAUTH_CLIENTS_FILE"`
+	UsersFile            string `env:"OAUTH_USERS_FILE"`
+	RefreshTokenRotation bool   `env:"OAUTH_REFRESH_TOKEN_ROTATION" envDefault:"true"`
+
+	// RefreshTokenTTL is the lifetime of refresh tokens, which are not issued
+	// if it is zero.
+	RefreshTokenTTL time.Duration `env:"OAUTH_REFRESH_TOKEN_TTL" envDefault:"24h"`
+
+	// Clients holds the clients loaded from ClientsFile.
+	Clients []Client
+
+	// Users holds the users loaded from UsersFile.
+	Users []User
+}
+
+// FindClient returns the client with the provided ID.
+func (o *OAuth) FindClient(id string) (*Client, bool) {
+	for i := range o.Clients {
+		if o.Clients[i].ID == id {
+			return &o.Clients[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// FindUser returns the user with the provided subject.
+func (o *OAuth) FindUser(subject string) (*User, bool) {
+	for i := range o.Users {
+		if o.Users[i].Subject == subject {
+			return &o.Users[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// FindUserByUsername returns the user with the provided username.
+func (o *OAuth) FindUserByUsername(username string) (*User, bool) {
+	for i := range o.Users {
+		if username != "" && o.Users[i].Username == username {
+			return &o.Users[i], true
+		}
+	}
+
+	return nil, false
 }
 
 type Server struct {
@@ -24,9 +235,18 @@ type Server struct {
 	HTTPReqTimeout time.Duration `env:"SERVER_HTTP_REQ_TIMEOUT" envDefault:"30s"`
 }
 
+type Admin struct {
+	// Token is the bearer token required by the admin endpoints. The admin
+	// endpoints are not authenticated if it is empty.
+	Token string `env:"ADMIN_TOKEN"`
+}
+
 type Config struct {
-	Server Server
-	JWK    JWK
+	Server   Server
+	JWK      JWK
+	Rotation Rotation
+	OAuth    OAuth
+	Admin    Admin
 }
 
 func New() (*Config, error) {
@@ -36,5 +256,151 @@ func New() (*Config, error) {
 		return nil, fmt.Errorf("failed to parse config: %w", err)
 	}
 
+	if cfg.JWK.KeyPassphraseFile != "" {
+		passphrase, err := readPassphrase(cfg.JWK.KeyPassphraseFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.JWK.KeyPassphrase = passphrase
+	}
+
+	if cfg.JWK.KeysFile != "" {
+		keys, err := loadKeys(cfg.JWK.KeysFile, cfg.JWK.RsaKeySize)
+		if err != nil {
+			return nil, err
+		}
+		cfg.JWK.Keys = keys
+	}
+
+	if cfg.JWK.ProfilesFile != "" {
+		profiles, err := loadProfiles(cfg.JWK.ProfilesFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.JWK.Profiles = profiles
+	}
+
+	if cfg.OAuth.ClientsFile != "" {
+		clients, err := loadClients(cfg.OAuth.ClientsFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.OAuth.Clients = clients
+	}
+
+	if cfg.OAuth.UsersFile != "" {
+		users, err := loadUsers(cfg.OAuth.UsersFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.OAuth.Users = users
+	}
+
 	return &cfg, nil
 }
+
+func loadKeys(path string, rsaKeySize int) ([]Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keys file: %w", err)
+	}
+
+	var keys []Key
+	if err = json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidKeys, err)
+	}
+
+	for i := range keys {
+		if keys[i].Alg == "" {
+			return nil, fmt.Errorf("%w: missing alg for key %d", ErrInvalidKeys, i)
+		}
+		if keys[i].RsaKeySize == 0 {
+			keys[i].RsaKeySize = rsaKeySize
+		}
+		if keys[i].PassphraseFile != "" {
+			if keys[i].Passphrase, err = readPassphrase(keys[i].PassphraseFile); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return keys, nil
+}
+
+func loadProfiles(path string) (map[string]Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles file: %w", err)
+	}
+
+	var profiles map[string]Profile
+	if err = json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidProfiles, err)
+	}
+
+	return profiles, nil
+}
+
+func loadClients(path string) ([]Client, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read clients file: %w", err)
+	}
+
+	var clients []Client
+	if err = json.Unmarshal(data, &clients); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidClients, err)
+	}
+
+	seen := make(map[string]bool, len(clients))
+	for i, client := range clients {
+		if client.ID == "" {
+			return nil, fmt.Errorf("%w: missing client_id for client %d", ErrInvalidClients, i)
+		}
+		if seen[client.ID] {
+			return nil, fmt.Errorf("%w: duplicate client_id %s", ErrInvalidClients, client.ID)
+		}
+		seen[client.ID] = true
+	}
+
+	return clients, nil
+}
+
+func loadUsers(path string) ([]User, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users file: %w", err)
+	}
+
+	var users []User
+	if err = json.Unmarshal(data, &users); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidUsers, err)
+	}
+
+	subjects := make(map[string]bool, len(users))
+	usernames := make(map[string]bool, len(users))
+	for i, user := range users {
+		if user.Subject == "" {
+			return nil, fmt.Errorf("%w: missing sub for user %d", ErrInvalidUsers, i)
+		}
+		if subjects[user.Subject] {
+			return nil, fmt.Errorf("%w: duplicate sub %s", ErrInvalidUsers, user.Subject)
+		}
+		if user.Username != "" && usernames[user.Username] {
+			return nil, fmt.Errorf("%w: duplicate username %s", ErrInvalidUsers, user.Username)
+		}
+		subjects[user.Subject] = true
+		usernames[user.Username] = true
+	}
+
+	return users, nil
+}
+
+func readPassphrase(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase file: %w", err)
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
@@ -2,6 +2,8 @@ package config_test
 
 import (
 	"net"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -25,6 +27,31 @@ func TestNew(t *testing.T) {
 		assert.Empty(t, cfg.JWK.KeyOps)
 		assert.Equal(t, 2048, cfg.JWK.RsaKeySize)
 		assert.False(t, cfg.JWK.FlattenAudience)
+		assert.Empty(t, cfg.JWK.KeyID)
+		assert.Empty(t, cfg.JWK.HMACSecret)
+		assert.Empty(t, cfg.JWK.DefaultKeyID)
+		assert.Empty(t, cfg.JWK.KeyPassphrase)
+		assert.False(t, cfg.JWK.PersistKey)
+		assert.Empty(t, cfg.JWK.Seed)
+		assert.Empty(t, cfg.JWK.KeysDir)
+		assert.Equal(t, 2*time.Second, cfg.JWK.KeysDirInterval)
+		assert.Empty(t, cfg.JWK.CertFile)
+		assert.False(t, cfg.JWK.SelfSignedCert)
+		assert.Empty(t, cfg.JWK.Claims.Issuer)
+		assert.Empty(t, cfg.JWK.Claims.Audience)
+		assert.Equal(t, time.Hour, cfg.JWK.Claims.TTL)
+		assert.Zero(t, cfg.JWK.Claims.NotBeforeSkew)
+		assert.True(t, cfg.JWK.Claims.JTI)
+		assert.Empty(t, cfg.JWK.Profiles)
+		assert.Zero(t, cfg.JWK.VerifySkew)
+		assert.Empty(t, cfg.OAuth.Clients)
+		assert.Empty(t, cfg.OAuth.Users)
+		assert.Equal(t, 24*time.Hour, cfg.OAuth.RefreshTokenTTL)
+		assert.True(t, cfg.OAuth.RefreshTokenRotation)
+		assert.Empty(t, cfg.Admin.Token)
+		assert.Empty(t, cfg.JWK.Keys)
+		assert.Zero(t, cfg.Rotation.Interval)
+		assert.Equal(t, 5*time.Minute, cfg.Rotation.GracePeriod)
 	})
 
 	t.Run("creates a new config using environment variables", func(t *testing.T) {
@@ -36,6 +63,24 @@ func TestNew(t *testing.T) {
 		t.Setenv("JWK_KEY_OPS", "sign,verify")
 		t.Setenv("SERVER_HTTP_REQ_TIMEOUT", "60s")
 		t.Setenv("JWK_FLATTEN_AUDIENCE", "true")
+		t.Setenv("JWK_KEY_ID", "primary")
+		t.Setenv("JWK_HMAC_SECRET", "secret")
+		t.Setenv("JWK_DEFAULT_KEY_ID", "secondary")
+		t.Setenv("JWK_ROTATION_INTERVAL", "1h")
+		t.Setenv("JWK_ROTATION_GRACE_PERIOD", "10m")
+		t.Setenv("JWK_KEY_PASSPHRASE", "passphrase")
+		t.Setenv("JWK_PERSIST_KEY", "true")
+		t.Setenv("JWK_SEED", "seed")
+		t.Setenv("JWK_KEYS_DIR", "/tmp/keys")
+		t.Setenv("JWK_KEYS_DIR_INTERVAL", "5s")
+		t.Setenv("JWK_CERT_FILE", "/tmp/cert.pem")
+		t.Setenv("JWK_SELF_SIGNED_CERT", "true")
+		t.Setenv("JWT_ISSUER", "https://issuer.example.com")
+		t.Setenv("JWT_AUDIENCE", "api,web")
+		t.Setenv("JWT_TTL", "15m")
+		t.Setenv("JWT_NBF_SKEW", "30s")
+		t.Setenv("JWT_JTI", "false")
+		t.Setenv("JWT_VERIFY_SKEW", "1m")
 
 		cfg, err := config.New()
 		require.NoError(t, err)
@@ -47,6 +92,228 @@ func TestNew(t *testing.T) {
 		assert.Equal(t, 4096, cfg.JWK.RsaKeySize)
 		assert.Equal(t, jwk.KeyOperationList{"sign", "verify"}, cfg.JWK.KeyOps)
 		assert.True(t, cfg.JWK.FlattenAudience)
+		assert.Equal(t, "primary", cfg.JWK.KeyID)
+		assert.Equal(t, "secret", cfg.JWK.HMACSecret)
+		assert.Equal(t, "secondary", cfg.JWK.DefaultKeyID)
+		assert.Equal(t, time.Hour, cfg.Rotation.Interval)
+		assert.Equal(t, 10*time.Minute, cfg.Rotation.GracePeriod)
+		assert.Equal(t, "passphrase", cfg.JWK.KeyPassphrase)
+		assert.Equal(t, "passphrase", cfg.JWK.PrimaryKey().Passphrase)
+		assert.True(t, cfg.JWK.PersistKey)
+		assert.True(t, cfg.JWK.PrimaryKey().Persist)
+		assert.Equal(t, "seed", cfg.JWK.Seed)
+		assert.Equal(t, "seed", cfg.JWK.PrimaryKey().Seed)
+		assert.Equal(t, "/tmp/keys", cfg.JWK.KeysDir)
+		assert.Equal(t, 5*time.Second, cfg.JWK.KeysDirInterval)
+		assert.Equal(t, "/tmp/cert.pem", cfg.JWK.CertFile)
+		assert.Equal(t, "/tmp/cert.pem", cfg.JWK.PrimaryKey().CertFile)
+		assert.True(t, cfg.JWK.SelfSignedCert)
+		assert.True(t, cfg.JWK.PrimaryKey().SelfSignedCert)
+		assert.Equal(t, "https://issuer.example.com", cfg.JWK.Claims.Issuer)
+		assert.Equal(t, []string{"api", "web"}, cfg.JWK.Claims.Audience)
+		assert.Equal(t, 15*time.Minute, cfg.JWK.Claims.TTL)
+		assert.Equal(t, 30*time.Second, cfg.JWK.Claims.NotBeforeSkew)
+		assert.False(t, cfg.JWK.Claims.JTI)
+		assert.Equal(t, time.Minute, cfg.JWK.VerifySkew)
+		assert.Empty(t, cfg.JWK.AllKeys(), "the keys directory replaces the primary key")
+	})
+
+	t.Run("reads the key passphrase from a file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "passphrase")
+		require.NoError(t, os.WriteFile(path, []byte("passphrase\n"), 0o600))
+
+		t.Setenv("JWK_KEY_PASSPHRASE_FILE", path)
+
+		cfg, err := config.New()
+		require.NoError(t, err)
+		assert.Equal(t, "passphrase", cfg.JWK.KeyPassphrase)
+	})
+
+	t.Run("returns an error if the passphrase file does not exist", func(t *testing.T) {
+		t.Setenv("JWK_KEY_PASSPHRASE_FILE", filepath.Join(t.TempDir(), "missing"))
+
+		cfg, err := config.New()
+		assert.Nil(t, cfg)
+		assert.Error(t, err)
+	})
+
+	t.Run("loads additional keys from the keys file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "keys.json")
+		passphrasePath := filepath.Join(t.TempDir(), "passphrase")
+		data := `[
+			{"alg": "ES256", "kid": "ec", "key_ops": ["sign"]},
+			{"alg": "RS512", "key_file": "/tmp/rsa.pem", "rsa_key_size": 4096},
+			{"alg": "HS256", "hmac_secret": "secret"},
+			{"alg": "ES384", "key_file": "/tmp/ec.pem", "passphrase_file": "` + passphrasePath + `"}
+		]`
+		require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+		require.NoError(t, os.WriteFile(passphrasePath, []byte("passphrase"), 0o600))
+
+		t.Setenv("JWK_KEYS_FILE", path)
+		t.Setenv("JWK_KEY_ID", "primary")
+
+		cfg, err := config.New()
+		require.NoError(t, err)
+		assert.Equal(t, []config.Key{
+			{Alg: jwa.ES256, KeyID: "ec", KeyOps: jwk.KeyOperationList{"sign"}, RsaKeySize: 2048},
+			{Alg: jwa.RS512, KeyFile: "/tmp/rsa.pem", RsaKeySize: 4096},
+			{Alg: jwa.HS256, HMACSecret: "secret", RsaKeySize: 2048},
+			{
+				Alg:            jwa.ES384,
+				KeyFile:        "/tmp/ec.pem",
+				RsaKeySize:     2048,
+				Passphrase:     "passphrase",
+				PassphraseFile: passphrasePath,
+			},
+		}, cfg.JWK.Keys)
+
+		keys := cfg.JWK.AllKeys()
+		assert.Len(t, keys, 5)
+		assert.Equal(t, "primary", keys[0].KeyID)
+		assert.Equal(t, jwa.RS256, keys[0].Alg)
+	})
+
+	t.Run("returns an error if the keys file is invalid", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "keys.json")
+		require.NoError(t, os.WriteFile(path, []byte(`[{"kid": "no-alg"}]`), 0o600))
+
+		t.Setenv("JWK_KEYS_FILE", path)
+
+		cfg, err := config.New()
+		assert.Nil(t, cfg)
+		require.ErrorIs(t, err, config.ErrInvalidKeys)
+		assert.EqualError(t, err, "invalid keys file: missing alg for key 0")
+	})
+
+	t.Run("returns an error if the keys file does not exist", func(t *testing.T) {
+		t.Setenv("JWK_KEYS_FILE", filepath.Join(t.TempDir(), "missing.json"))
+
+		cfg, err := config.New()
+		assert.Nil(t, cfg)
+		assert.Error(t, err)
+	})
+
+	t.Run("loads token profiles from the profiles file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "profiles.json")
+		data := `{
+			"admin": {"claims": {"sub": "admin", "roles": ["admin"]}, "ttl": "15m", "kid": "ec"},
+			"service": {"claims": {"sub": "svc"}, "headers": {"typ": "at+jwt"}, "alg": "RS256", "ttl": "0s"}
+		}`
+		require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+
+		t.Setenv("JWT_PROFILES_FILE", path)
+
+		cfg, err := config.New()
+		require.NoError(t, err)
+		require.Len(t, cfg.JWK.Profiles, 2)
+
+		admin := cfg.JWK.Profiles["admin"]
+		assert.Equal(t, map[string]interface{}{"sub": "admin", "roles": []interface{}{"admin"}}, admin.Claims)
+		assert.Equal(t, "ec", admin.KeyID)
+		require.NotNil(t, admin.TTL)
+		assert.Equal(t, config.Duration(15*time.Minute), *admin.TTL)
+
+		service := cfg.JWK.Profiles["service"]
+		assert.Equal(t, map[string]interface{}{"typ": "at+jwt"}, service.Headers)
+		assert.Equal(t, jwa.RS256, service.Alg)
+		require.NotNil(t, service.TTL)
+		assert.Zero(t, *service.TTL)
+	})
+
+	t.Run("returns an error if the profiles file is invalid", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "profiles.json")
+		require.NoError(t, os.WriteFile(path, []byte(`{"admin": {"ttl": "forever"}}`), 0o600))
+
+		t.Setenv("JWT_PROFILES_FILE", path)
+
+		cfg, err := config.New()
+		assert.Nil(t, cfg)
+		require.ErrorIs(t, err, config.ErrInvalidProfiles)
+	})
+
+	t.Run("loads OAuth clients from the clients file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "clients.json")
+		data := `[
+			{"client_id": "service", "client_secret": "secret", "scopes": ["read"], "audience": ["api"]},
+			{"client_id": "spa"}
+		]`
+		require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+
+		t.Setenv("OAUTH_CLIENTS_FILE", path)
+
+		cfg, err := config.New()
+		require.NoError(t, err)
+		assert.Equal(t, []config.Client{
+			{ID: "service", Secret: "secret", Scopes: []string{"read"}, Audience: []string{"api"}},
+			{ID: "spa"},
+		}, cfg.OAuth.Clients)
+
+		client, ok := cfg.OAuth.FindClient("spa")
+		require.True(t, ok)
+		assert.Equal(t, "spa", client.ID)
+
+		_, ok = cfg.OAuth.FindClient("missing")
+		assert.False(t, ok)
+	})
+
+	t.Run("returns an error if the clients file is invalid", func(t *testing.T) {
+		for _, data := range []string{`[{"client_secret": "secret"}]`, `[{"client_id": "a"}, {"client_id": "a"}]`, `{}`} {
+			path := filepath.Join(t.TempDir(), "clients.json")
+			require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+
+			t.Setenv("OAUTH_CLIENTS_FILE", path)
+
+			cfg, err := config.New()
+			assert.Nil(t, cfg)
+			require.ErrorIs(t, err, config.ErrInvalidClients)
+		}
+	})
+
+	t.Run("loads OAuth users from the users file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "users.json")
+		data := `[{"sub": "alice", "username": "alice", "password": "secret", "claims": {"name": "Alice"}}, {"sub": "bob"}]`
+		require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+
+		t.Setenv("OAUTH_USERS_FILE", path)
+
+		cfg, err := config.New()
+		require.NoError(t, err)
+		assert.Equal(t, []config.User{
+			{Subject: "alice", Username: "alice", Password: "secret", Claims: map[string]interface{}{"name": "Alice"}},
+			{Subject: "bob"},
+		}, cfg.OAuth.Users)
+
+		user, ok := cfg.OAuth.FindUser("bob")
+		require.True(t, ok)
+		assert.Equal(t, "bob", user.Subject)
+
+		_, ok = cfg.OAuth.FindUser("missing")
+		assert.False(t, ok)
+
+		user, ok = cfg.OAuth.FindUserByUsername("alice")
+		require.True(t, ok)
+		assert.Equal(t, "alice", user.Subject)
+
+		_, ok = cfg.OAuth.FindUserByUsername("")
+		assert.False(t, ok)
+	})
+
+	t.Run("returns an error if the users file is invalid", func(t *testing.T) {
+		for _, data := range []string{
+			`[{"claims": {}}]`,
+			`[{"sub": "a"}, {"sub": "a"}]`,
+			`[{"sub": "a", "username": "u"}, {"sub": "b", "username": "u"}]`,
+			`{}`,
+		} {
+			path := filepath.Join(t.TempDir(), "users.json")
+			require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+
+			t.Setenv("OAUTH_USERS_FILE", path)
+
+			cfg, err := config.New()
+			assert.Nil(t, cfg)
+			require.ErrorIs(t, err, config.ErrInvalidUsers)
+		}
 	})
 
 	t.Run("returns an error if environment variables are invalid", func(t *testing.T) {
@@ -0,0 +1,244 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/murar8/local-jwks-server/internal/config"
+	"github.com/murar8/local-jwks-server/internal/rotation"
+	"github.com/murar8/local-jwks-server/internal/token"
+)
+
+type AdminHandler interface {
+	HandleRotationStatus(w http.ResponseWriter, r *http.Request)
+	HandleListKeys(w http.ResponseWriter, r *http.Request)
+	HandleAddKey(w http.ResponseWriter, r *http.Request)
+	HandleRotateKey(w http.ResponseWriter, r *http.Request)
+	HandleDeleteKey(w http.ResponseWriter, r *http.Request)
+	HandleGetSecret(w http.ResponseWriter, r *http.Request)
+}
+
+type adminHandler struct {
+	tokenService token.Service
+	rotator      *rotation.Rotator
+	cfg          *config.JWK
+}
+
+func NewAdmin(tokenService token.Service, rotator *rotation.Rotator, cfg *config.JWK) AdminHandler {
+	return &adminHandler{tokenService, rotator, cfg}
+}
+
+// AdminAuth protects the admin endpoints with a bearer token. Requests are
+// let through unchecked if no token is configured.
+func AdminAuth(adminToken string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if adminToken != "" && !hasBearerToken(r, adminToken) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+				res := &ErrorResponse{Error: "invalid admin token", StatusCode: http.StatusUnauthorized}
+				render.Render(w, r, res)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireAdminToken is like AdminAuth, but rejects every request if no token
+// is configured. It protects the endpoints exposing secrets.
+func RequireAdminToken(adminToken string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if adminToken == "" {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				res := &ErrorResponse{Error: "ADMIN_TOKEN must be set to use this endpoint", StatusCode: http.StatusForbidden}
+				render.Render(w, r, res)
+			})
+		}
+
+		return AdminAuth(adminToken)(next)
+	}
+}
+
+func hasBearerToken(r *http.Request, expected string) bool {
+	scheme, credentials, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(strings.TrimSpace(credentials)), []byte(expected)) == 1
+}
+
+// AddKeyRequest describes a key to be added at runtime. The key is imported
+// from PEM or from the HMAC secret if provided, otherwise it is generated.
+// Encrypted PEM keys are decrypted with Passphrase, and generated keys are
+// derived from Seed if provided. The certificate chain is loaded from Cert,
+// or self-signed if SelfSignedCert is set.
+type AddKeyRequest struct {
+	Alg        jwa.SignatureAlgorithm `json:"alg"`
+	KeyID      string                 `json:"kid"`
+	KeyOps     jwk.KeyOperationList   `json:"key_ops"`
+	RsaKeySize int                    `json:"rsa_key_size"`
+	PEM        string                 `json:"pem"`
+	HMACSecret string                 `json:"hmac_secret"`
+	Passphrase string                 `json:"passphrase"`
+	Seed       string                 `json:"seed"`
+	Cert       string                 `json:"cert"`
+	Default    bool                   `json:"default"`
+
+	SelfSignedCert bool `json:"self_signed_cert"`
+}
+
+func (h *adminHandler) HandleRotationStatus(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, h.rotator.Status())
+}
+
+func (h *adminHandler) HandleListKeys(w http.ResponseWriter, r *http.Request) {
+	status := h.rotator.Status()
+	keys := h.tokenService.GetKeys()
+
+	res := make([]*AdminKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		res = append(res, newAdminKeyResponse(key, &status))
+	}
+
+	render.JSON(w, r, res)
+}
+
+func (h *adminHandler) HandleAddKey(w http.ResponseWriter, r *http.Request) {
+	var req AddKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		res := &ErrorResponse{Error: err.Error(), StatusCode: http.StatusUnprocessableEntity}
+		render.Render(w, r, res)
+		return
+	}
+
+	if req.Alg == "" {
+		req.Alg = h.cfg.Alg
+	}
+	if req.RsaKeySize == 0 {
+		req.RsaKeySize = h.cfg.RsaKeySize
+	}
+
+	key, err := createKey(&req)
+	if err != nil {
+		res := &ErrorResponse{Error: err.Error(), StatusCode: http.StatusBadRequest}
+		render.Render(w, r, res)
+		return
+	}
+
+	if err = h.tokenService.AddKey(key); err != nil {
+		res := &ErrorResponse{Error: err.Error(), StatusCode: errorStatusCode(err)}
+		render.Render(w, r, res)
+		return
+	}
+
+	if req.Default {
+		if err = h.tokenService.SetDefaultKey(key.KeyID()); err != nil {
+			res := &ErrorResponse{Error: err.Error(), StatusCode: errorStatusCode(err)}
+			render.Render(w, r, res)
+			return
+		}
+	}
+
+	status := h.rotator.Status()
+	render.Render(w, r, newAdminKeyResponse(key, &status))
+}
+
+func createKey(req *AddKeyRequest) (jwk.Key, error) {
+	var raw interface{}
+	var err error
+
+	switch {
+	case req.HMACSecret != "":
+		raw, err = token.ParsePrivateKey([]byte(req.HMACSecret), req.Alg)
+	case req.PEM != "":
+		raw, err = token.ParsePrivateKey([]byte(req.PEM), req.Alg, token.WithPassphrase([]byte(req.Passphrase)))
+	default:
+		raw, err = token.GeneratePrivateKey(req.Alg, req.RsaKeySize, token.WithSeed([]byte(req.Seed)))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := token.NewKey(raw, &config.Key{Alg: req.Alg, KeyID: req.KeyID, KeyOps: req.KeyOps})
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case req.Cert != "":
+		var chain []*x509.Certificate
+		if chain, err = token.ParseCertificateChain([]byte(req.Cert)); err == nil {
+			err = token.SetCertificateChain(key, chain)
+		}
+	case req.SelfSignedCert:
+		err = token.EnsureCertificate(key)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func (h *adminHandler) HandleRotateKey(w http.ResponseWriter, r *http.Request) {
+	key, err := h.rotator.Rotate()
+	if err != nil {
+		res := &ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError}
+		render.Render(w, r, res)
+		return
+	}
+
+	status := h.rotator.Status()
+	render.Render(w, r, newAdminKeyResponse(key, &status))
+}
+
+func (h *adminHandler) HandleDeleteKey(w http.ResponseWriter, r *http.Request) {
+	if err := h.tokenService.RemoveKey(chi.URLParam(r, "kid")); err != nil {
+		res := &ErrorResponse{Error: err.Error(), StatusCode: errorStatusCode(err)}
+		render.Render(w, r, res)
+		return
+	}
+
+	render.NoContent(w, r)
+}
+
+// HandleGetSecret exposes an HMAC secret as a JWK so that tests can verify
+// symmetric tokens. Secrets are never published in the JWKS, and this
+// endpoint must be protected with RequireAdminToken.
+func (h *adminHandler) HandleGetSecret(w http.ResponseWriter, r *http.Request) {
+	key, err := h.tokenService.FindKey(chi.URLParam(r, "kid"), "")
+	if err != nil {
+		res := &ErrorResponse{Error: err.Error(), StatusCode: errorStatusCode(err)}
+		render.Render(w, r, res)
+		return
+	}
+
+	if !token.IsSymmetric(key) {
+		res := &ErrorResponse{Error: "key is not an HMAC secret", StatusCode: http.StatusBadRequest}
+		render.Render(w, r, res)
+		return
+	}
+
+	render.JSON(w, r, key)
+}
+
+func errorStatusCode(err error) int {
+	switch {
+	case errors.Is(err, token.ErrKeyNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, token.ErrDuplicateKeyID), errors.Is(err, token.ErrDefaultKey):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,235 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/murar8/local-jwks-server/internal/authcode"
+	"github.com/murar8/local-jwks-server/internal/config"
+)
+
+const loginPageTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Sign in - local-jwks-server</title>
+<style>
+body { font-family: sans-serif; max-width: 32rem; margin: 2rem auto; padding: 0 1rem; }
+button { display: block; width: 100%; margin: 0.5rem 0; padding: 0.5rem; }
+textarea { width: 100%; height: 8rem; font-family: monospace; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>
+<h1>Sign in to {{.ClientID}}</h1>
+{{with .Error}}<p class="error">{{.}}</p>{{end}}
+<form method="post">
+{{range .Params}}<input type="hidden" name="{{.Name}}" value="{{.Value}}">
+{{end}}
+{{range .Users}}<button type="submit" name="sub" value="{{.Subject}}">{{.Subject}}{{with index .Claims "name"}} ({{.}}){{end}}</button>
+{{end}}
+</form>
+<form method="post">
+{{range .Params}}<input type="hidden" name="{{.Name}}" value="{{.Value}}">
+{{end}}
+<label for="claims">Or sign in with custom claims, including <code>sub</code>:</label>
+<textarea id="claims" name="claims">{"sub": "user"}</textarea>
+<button type="submit">Sign in</button>
+</form>
+</body>
+</html>
+`
+
+type loginPageParam struct {
+	Name  string
+	Value string
+}
+
+type loginPage struct {
+	ClientID string
+	Params   []loginPageParam
+	Users    []config.User
+	Error    string
+}
+
+// authorizeRequest is a validated authorization request.
+type authorizeRequest struct {
+	params      url.Values
+	client      *config.Client
+	redirectURI string
+	scopes      []string
+}
+
+// HandleAuthorize renders the login page of the authorization endpoint.
+func (h *oauthHandler) HandleAuthorize(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.parseAuthorizeRequest(w, r, r.URL.Query())
+	if !ok {
+		return
+	}
+
+	h.renderLoginPage(w, req, http.StatusOK, "")
+}
+
+// HandleAuthorizeLogin signs in the identity selected on the login page and
+// redirects back to the client with an authorization code.
+func (h *oauthHandler) HandleAuthorizeLogin(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req, ok := h.parseAuthorizeRequest(w, r, r.PostForm)
+	if !ok {
+		return
+	}
+
+	var claims map[string]interface{}
+
+	if sub := r.PostForm.Get("sub"); sub != "" {
+		user, exists := h.cfg.OAuth.FindUser(sub)
+		if !exists {
+			h.renderLoginPage(w, req, http.StatusBadRequest, "unknown user "+sub)
+			return
+		}
+		claims = merge(user.Claims, map[string]interface{}{"sub": user.Subject})
+	} else {
+		if err := json.Unmarshal([]byte(r.PostForm.Get("claims")), &claims); err != nil {
+			h.renderLoginPage(w, req, http.StatusBadRequest, "invalid claims: "+err.Error())
+			return
+		}
+		if sub, _ := claims["sub"].(string); sub == "" {
+			h.renderLoginPage(w, req, http.StatusBadRequest, "the claims must include a sub")
+			return
+		}
+	}
+
+	code := h.codes.Issue(authcode.Grant{
+		ClientID:            req.client.ID,
+		RedirectURI:         req.params.Get("redirect_uri"),
+		Scopes:              req.scopes,
+		Claims:              claims,
+		Nonce:               req.params.Get("nonce"),
+		CodeChallenge:       req.params.Get("code_challenge"),
+		CodeChallengeMethod: req.params.Get("code_challenge_method"),
+		AuthTime:            time.Now(),
+	})
+
+	redirect(w, r, req, url.Values{"code": {code}})
+}
+
+// parseAuthorizeRequest validates an authorization request. Errors about the
+// client or the redirect URI are shown to the user, while the other errors
+// are sent back to the client as described in RFC 6749 section 4.1.2.1.
+func (h *oauthHandler) parseAuthorizeRequest(
+	w http.ResponseWriter,
+	r *http.Request,
+	params url.Values,
+) (*authorizeRequest, bool) {
+	client, exists := h.cfg.OAuth.FindClient(params.Get("client_id"))
+	if !exists {
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return nil, false
+	}
+
+	redirectURI := params.Get("redirect_uri")
+	switch {
+	case redirectURI == "" && len(client.RedirectURIs) == 1:
+		redirectURI = client.RedirectURIs[0]
+	case !slices.Contains(client.RedirectURIs, redirectURI):
+		http.Error(w, "redirect_uri is not registered for this client", http.StatusBadRequest)
+		return nil, false
+	}
+
+	req := &authorizeRequest{params: params, client: client, redirectURI: redirectURI}
+
+	// The challenge method defaults to plain, see RFC 7636 section 4.3.
+	if params.Get("code_challenge") != "" && params.Get("code_challenge_method") == "" {
+		params.Set("code_challenge_method", authcode.ChallengePlain)
+	}
+
+	var errCode, description string
+	switch {
+	case params.Get("response_type") != "code":
+		errCode, description = "unsupported_response_type", "only the code response type is supported"
+	case client.Secret == "" && params.Get("code_challenge") == "":
+		errCode, description = errInvalidRequest, "public clients must use PKCE"
+	case params.Get("code_challenge") != "" && !authcode.IsSupportedChallengeMethod(params.Get("code_challenge_method")):
+		errCode, description = errInvalidRequest, "unsupported code_challenge_method"
+	default:
+		var ok bool
+		if req.scopes, ok = authorizeScopes(params.Get("scope"), client.Scopes); !ok {
+			errCode, description = errInvalidScope, "the requested scope is not allowed for this client"
+		}
+	}
+
+	if errCode != "" {
+		redirect(w, r, req, url.Values{"error": {errCode}, "error_description": {description}})
+		return nil, false
+	}
+
+	return req, true
+}
+
+// authorizeScopes validates the requested scopes like requestedScopes, except
+// that the openid scope is always allowed.
+func authorizeScopes(scope string, allowed []string) ([]string, bool) {
+	requested := strings.Fields(scope)
+	openid := slices.Contains(requested, "openid")
+	requested = slices.DeleteFunc(requested, func(s string) bool { return s == "openid" })
+
+	scopes, ok := requestedScopes(strings.Join(requested, " "), allowed)
+	if ok && openid {
+		scopes = append([]string{"openid"}, scopes...)
+	}
+
+	return scopes, ok
+}
+
+// redirect sends the user back to the client with the response parameters
+// and the state of the authorization request.
+func redirect(w http.ResponseWriter, r *http.Request, req *authorizeRequest, response url.Values) {
+	u, err := url.Parse(req.redirectURI)
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	if state := req.params.Get("state"); state != "" {
+		response.Set("state", state)
+	}
+
+	query := u.Query()
+	for name, values := range response {
+		query[name] = values
+	}
+	u.RawQuery = query.Encode()
+
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+func (h *oauthHandler) renderLoginPage(w http.ResponseWriter, req *authorizeRequest, statusCode int, message string) {
+	page := loginPage{ClientID: req.client.ID, Users: h.cfg.OAuth.Users, Error: message}
+	// The authorization request parameters are carried through the login page.
+	for _, name := range []string{
+		"response_type",
+		"client_id",
+		"redirect_uri",
+		"scope",
+		"state",
+		"nonce",
+		"code_challenge",
+		"code_challenge_method",
+	} {
+		if value := req.params.Get(name); value != "" {
+			page.Params = append(page.Params, loginPageParam{name, value})
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(statusCode)
+	_ = h.loginPage.Execute(w, page)
+}
@@ -0,0 +1,260 @@
+package handler_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/murar8/local-jwks-server/internal/authcode"
+	"github.com/murar8/local-jwks-server/internal/refresh"
+	"github.com/murar8/local-jwks-server/internal/revocation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Example from RFC 7636 appendix B.
+const (
+	testCodeVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testCodeChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+func serveRequest(router http.Handler, req *http.Request) *http.Response {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Result()
+}
+
+// authorize signs in with the form and returns the redirect location.
+func authorize(t *testing.T, router http.Handler, form url.Values) *url.URL {
+	t.Helper()
+
+	res := serveRequest(router, newFormRequest(http.MethodPost, "/authorize", form))
+	require.Equal(t, http.StatusFound, res.StatusCode)
+
+	location, err := res.Location()
+	require.NoError(t, err)
+
+	return location
+}
+
+func publicAuthorizeForm() url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"public"},
+		"redirect_uri":          {"http://localhost:3000/callback?app=spa"},
+		"scope":                 {"openid"},
+		"state":                 {"xyz"},
+		"nonce":                 {"n-0S6_WzA2Mj"},
+		"code_challenge":        {testCodeChallenge},
+		"code_challenge_method": {"S256"},
+		"sub":                   {"alice"},
+	}
+}
+
+func TestHandleAuthorize(t *testing.T) {
+	t.Parallel()
+
+	t.Run("renders the login page", func(t *testing.T) {
+		t.Parallel()
+
+		query := publicAuthorizeForm()
+		query.Del("sub")
+		req := httptest.NewRequest(http.MethodGet, "/authorize?"+query.Encode(), nil)
+		res := serveOAuthRequest(makeTokenService(), revocation.New(), req)
+
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "text/html; charset=utf-8", res.Header.Get("Content-Type"))
+		assert.Contains(t, string(body), `name="sub" value="alice"`)
+		assert.Contains(t, string(body), "Alice")
+		assert.Contains(t, string(body), `name="state" value="xyz"`)
+	})
+
+	t.Run("does not redirect to unknown clients", func(t *testing.T) {
+		t.Parallel()
+
+		for _, query := range []string{
+			"response_type=code&client_id=missing",
+			"response_type=code&client_id=public&redirect_uri=https%3A%2F%2Fevil.example.com",
+		} {
+			req := httptest.NewRequest(http.MethodGet, "/authorize?"+query, nil)
+			res := serveOAuthRequest(makeTokenService(), revocation.New(), req)
+			assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+			assert.Empty(t, res.Header.Get("Location"))
+		}
+	})
+
+	t.Run("redirects invalid requests back to the client", func(t *testing.T) {
+		t.Parallel()
+
+		cases := []struct {
+			query url.Values
+			err   string
+		}{
+			{url.Values{"response_type": {"token"}, "client_id": {"service"}}, "unsupported_response_type"},
+			{url.Values{"response_type": {"code"}, "client_id": {"public"}}, "invalid_request"},
+			{url.Values{"response_type": {"code"}, "client_id": {"service"}, "scope": {"admin"}}, "invalid_scope"},
+			{
+				url.Values{"response_type": {"code"}, "client_id": {"service"}, "code_challenge": {"abc"}, "code_challenge_method": {"S512"}},
+				"invalid_request",
+			},
+		}
+
+		for _, c := range cases {
+			c.query.Set("state", "xyz")
+			req := httptest.NewRequest(http.MethodGet, "/authorize?"+c.query.Encode(), nil)
+			res := serveOAuthRequest(makeTokenService(), revocation.New(), req)
+			require.Equal(t, http.StatusFound, res.StatusCode)
+
+			location, err := res.Location()
+			require.NoError(t, err)
+			assert.Equal(t, "/callback", location.Path)
+			assert.Equal(t, c.err, location.Query().Get("error"))
+			assert.Equal(t, "xyz", location.Query().Get("state"))
+		}
+	})
+}
+
+func TestHandleTokenAuthorizationCode(t *testing.T) {
+	t.Parallel()
+
+	t.Run("issues an ID token to a public client using PKCE", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeTokenService()
+		router := newOAuthRouter(ts, revocation.New(), authcode.New(time.Minute), refresh.New(time.Hour), true)
+
+		location := authorize(t, router, publicAuthorizeForm())
+		assert.Equal(t, "/callback", location.Path)
+		assert.Equal(t, "spa", location.Query().Get("app"))
+		assert.Equal(t, "xyz", location.Query().Get("state"))
+
+		form := url.Values{
+			"grant_type":    {"authorization_code"},
+			"client_id":     {"public"},
+			"code":          {location.Query().Get("code")},
+			"redirect_uri":  {"http://localhost:3000/callback?app=spa"},
+			"code_verifier": {testCodeVerifier},
+		}
+		res := serveRequest(router, newFormRequest(http.MethodPost, "http://localhost:8080/oauth/token", form))
+
+		var data map[string]interface{}
+		decodeBody(t, res, &data)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "openid", data["scope"])
+		assert.NotEmpty(t, data["access_token"])
+
+		set, _ := ts.GetKeySet()
+		idToken, err := jwt.Parse([]byte(data["id_token"].(string)), jwt.WithKeySet(set))
+		require.NoError(t, err)
+		assert.Equal(t, "http://localhost:8080", idToken.Issuer())
+		assert.Equal(t, "alice", idToken.Subject())
+		assert.Equal(t, []string{"public"}, idToken.Audience())
+		assert.Equal(t, "n-0S6_WzA2Mj", idToken.PrivateClaims()["nonce"])
+		assert.Equal(t, "Alice", idToken.PrivateClaims()["name"])
+		assert.Contains(t, idToken.PrivateClaims(), "auth_time")
+
+		// Codes can only be redeemed once.
+		res = serveRequest(router, newFormRequest(http.MethodPost, "/oauth/token", form))
+		decodeBody(t, res, &data)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+		assert.Equal(t, "invalid_grant", data["error"])
+	})
+
+	t.Run("signs in with custom claims", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeTokenService()
+		router := newOAuthRouter(ts, revocation.New(), authcode.New(time.Minute), refresh.New(time.Hour), true)
+
+		form := publicAuthorizeForm()
+		form.Del("sub")
+		form.Set("claims", `{"sub": "bob", "email": "bob@example.com"}`)
+		location := authorize(t, router, form)
+
+		res := serveRequest(router, newFormRequest(http.MethodPost, "/oauth/token", url.Values{
+			"grant_type":    {"authorization_code"},
+			"client_id":     {"public"},
+			"code":          {location.Query().Get("code")},
+			"redirect_uri":  {"http://localhost:3000/callback?app=spa"},
+			"code_verifier": {testCodeVerifier},
+		}))
+
+		var data map[string]interface{}
+		decodeBody(t, res, &data)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		idToken, err := jwt.Parse([]byte(data["id_token"].(string)), jwt.WithVerify(false))
+		require.NoError(t, err)
+		assert.Equal(t, "bob", idToken.Subject())
+		assert.Equal(t, "bob@example.com", idToken.PrivateClaims()["email"])
+	})
+
+	t.Run("rejects claims without a subject", func(t *testing.T) {
+		t.Parallel()
+
+		form := publicAuthorizeForm()
+		form.Del("sub")
+		form.Set("claims", `{"name": "Bob"}`)
+		res := makeOAuthRequest(makeTokenService(), http.MethodPost, "/authorize", form)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("issues only an access token without the openid scope", func(t *testing.T) {
+		t.Parallel()
+
+		router := newOAuthRouter(makeTokenService(), revocation.New(), authcode.New(time.Minute), refresh.New(time.Hour), true)
+		location := authorize(t, router, url.Values{"response_type": {"code"}, "client_id": {"service"}, "sub": {"alice"}})
+
+		req := newFormRequest(http.MethodPost, "/oauth/token", url.Values{
+			"grant_type": {"authorization_code"},
+			"code":       {location.Query().Get("code")},
+		})
+		req.SetBasicAuth("service", url.QueryEscape("s3cr3t:/"))
+		res := serveRequest(router, req)
+
+		var data map[string]interface{}
+		decodeBody(t, res, &data)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "read write", data["scope"])
+		assert.NotContains(t, data, "id_token")
+	})
+
+	t.Run("rejects invalid grants", func(t *testing.T) {
+		t.Parallel()
+
+		cases := map[string]url.Values{
+			"wrong verifier": {"code_verifier": {"wrong"}},
+			"no verifier":    {"code_verifier": {""}},
+			"wrong redirect": {"redirect_uri": {"http://localhost:3000/other"}},
+			"wrong code":     {"code": {"unknown"}},
+		}
+
+		for name, override := range cases {
+			router := newOAuthRouter(makeTokenService(), revocation.New(), authcode.New(time.Minute), refresh.New(time.Hour), true)
+			location := authorize(t, router, publicAuthorizeForm())
+
+			form := url.Values{
+				"grant_type":    {"authorization_code"},
+				"client_id":     {"public"},
+				"code":          {location.Query().Get("code")},
+				"redirect_uri":  {"http://localhost:3000/callback?app=spa"},
+				"code_verifier": {testCodeVerifier},
+			}
+			for k, v := range override {
+				form[k] = v
+			}
+			res := serveRequest(router, newFormRequest(http.MethodPost, "/oauth/token", form))
+
+			var data map[string]interface{}
+			decodeBody(t, res, &data)
+			assert.Equal(t, http.StatusBadRequest, res.StatusCode, name)
+			assert.Equal(t, "invalid_grant", data["error"], name)
+		}
+	})
+}
@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/murar8/local-jwks-server/internal/authcode"
+	"github.com/murar8/local-jwks-server/internal/config"
+	"github.com/murar8/local-jwks-server/internal/token"
+)
+
+type DiscoveryHandler interface {
+	HandleOpenIDConfiguration(w http.ResponseWriter, r *http.Request)
+	HandleAuthorizationServerMetadata(w http.ResponseWriter, r *http.Request)
+}
+
+type discoveryHandler struct {
+	tokenService token.Service
+	cfg          *config.JWK
+}
+
+func NewDiscovery(tokenService token.Service, cfg *config.JWK) DiscoveryHandler {
+	return &discoveryHandler{tokenService, cfg}
+}
+
+// AuthorizationServerMetadata is an RFC 8414 metadata document describing the
+// OAuth endpoints implemented by the server.
+type AuthorizationServerMetadata struct {
+	Issuer                            string   `json:"issuer"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+}
+
+// OpenIDConfiguration is an OpenID Connect discovery document.
+type OpenIDConfiguration struct {
+	AuthorizationServerMetadata
+
+	UserInfoEndpoint                 string   `json:"userinfo_endpoint"`
+	SubjectTypesSupported            []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+}
+
+// HandleOpenIDConfiguration serves the discovery document. Endpoint URLs are
+// derived from the request so that they are reachable by the client.
+func (h *discoveryHandler) HandleOpenIDConfiguration(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, &OpenIDConfiguration{
+		AuthorizationServerMetadata:      newMetadata(r, issuerURL(r, h.cfg)),
+		UserInfoEndpoint:                 baseURL(r) + "/userinfo",
+		SubjectTypesSupported:            []string{"public"},
+		IDTokenSigningAlgValuesSupported: signingAlgorithms(h.tokenService),
+	})
+}
+
+// HandleAuthorizationServerMetadata serves the RFC 8414 metadata. The tenant
+// path parameter selects a tenant, whose issuer is the server issuer followed
+// by the tenant as described in RFC 8414 section 3, and whose endpoints sign
+// tokens with that issuer.
+func (h *discoveryHandler) HandleAuthorizationServerMetadata(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, newMetadata(r, issuerURL(r, h.cfg)))
+}
+
+func newMetadata(r *http.Request, issuer string) AuthorizationServerMetadata {
+	base := baseURL(r)
+	endpoints := base + tenantPath(r)
+
+	return AuthorizationServerMetadata{
+		Issuer:                            issuer,
+		JWKSURI:                           base + "/.well-known/jwks.json",
+		AuthorizationEndpoint:             endpoints + "/authorize",
+		TokenEndpoint:                     endpoints + "/oauth/token",
+		IntrospectionEndpoint:             endpoints + "/oauth/introspect",
+		RevocationEndpoint:                endpoints + "/oauth/revoke",
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "client_credentials", "refresh_token", "password"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{authcode.ChallengeS256, authcode.ChallengePlain},
+	}
+}
+
+// baseURL returns the URL the client used to reach the server, honoring the
+// headers set by reverse proxies.
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+
+	host := r.Host
+	if forwarded := r.Header.Get("X-Forwarded-Host"); forwarded != "" {
+		host = forwarded
+	}
+
+	return scheme + "://" + host
+}
+
+// issuerURL returns the configured issuer, or the base URL of the request if
+// no issuer is configured, followed by the tenant of the request if any.
+func issuerURL(r *http.Request, cfg *config.JWK) string {
+	issuer := cfg.Claims.Issuer
+	if issuer == "" {
+		issuer = baseURL(r)
+	}
+
+	if tenant := tenantPath(r); tenant != "" {
+		return strings.TrimSuffix(issuer, "/") + tenant
+	}
+
+	return issuer
+}
+
+// tenantPath returns the path of the tenant selected by the tenant route
+// parameter, or an empty string if there is none.
+func tenantPath(r *http.Request) string {
+	if tenant := chi.URLParam(r, "tenant"); tenant != "" {
+		return "/" + tenant
+	}
+
+	return ""
+}
+
+// signingAlgorithms returns the sorted algorithms of the loaded keys. HMAC
+// secrets are left out since relying parties cannot verify tokens signed
+// with them.
+func signingAlgorithms(tokenService token.Service) []string {
+	var algs []string
+	for _, key := range tokenService.GetKeys() {
+		if !token.IsSymmetric(key) {
+			algs = append(algs, key.Algorithm().String())
+		}
+	}
+
+	slices.Sort(algs)
+
+	return slices.Compact(algs)
+}
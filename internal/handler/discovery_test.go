@@ -0,0 +1,143 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/murar8/local-jwks-server/internal/config"
+	"github.com/murar8/local-jwks-server/internal/handler"
+	"github.com/murar8/local-jwks-server/internal/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeDiscoveryRequest(ts token.Service, cfg *config.JWK, headers map[string]string) *http.Response {
+	return makeDiscoveryRequestWithPath(ts, cfg, "/.well-known/openid-configuration", headers)
+}
+
+func makeDiscoveryRequestWithPath(ts token.Service, cfg *config.JWK, path string, headers map[string]string) *http.Response {
+	req := httptest.NewRequest(http.MethodGet, "http://localhost:8080"+path, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	h := handler.NewDiscovery(ts, cfg)
+	router := chi.NewRouter()
+	router.Get("/.well-known/openid-configuration", h.HandleOpenIDConfiguration)
+	router.Get("/.well-known/oauth-authorization-server", h.HandleAuthorizationServerMetadata)
+	router.Get("/.well-known/oauth-authorization-server/{tenant}", h.HandleAuthorizationServerMetadata)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Result()
+}
+
+func TestHandleOpenIDConfiguration(t *testing.T) {
+	t.Parallel()
+
+	t.Run("derives the URLs from the request", func(t *testing.T) {
+		t.Parallel()
+
+		res := makeDiscoveryRequest(makeMultiKeyTokenService(), &config.JWK{}, nil)
+
+		var data map[string]interface{}
+		decodeBody(t, res, &data)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "http://localhost:8080", data["issuer"])
+		assert.Equal(t, "http://localhost:8080/.well-known/jwks.json", data["jwks_uri"])
+		assert.Equal(t, "http://localhost:8080/oauth/introspect", data["introspection_endpoint"])
+		assert.Equal(t, "http://localhost:8080/oauth/revoke", data["revocation_endpoint"])
+		assert.Equal(t, []interface{}{"ES256", "RS256"}, data["id_token_signing_alg_values_supported"])
+		assert.Equal(t, "http://localhost:8080/userinfo", data["userinfo_endpoint"])
+		assert.Equal(t, []interface{}{"public"}, data["subject_types_supported"])
+	})
+
+	t.Run("uses the configured issuer and the forwarded host", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := &config.JWK{Claims: config.Claims{Issuer: "https://issuer.example.com"}}
+		headers := map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "auth.example.com"}
+		res := makeDiscoveryRequest(makeTokenService(), cfg, headers)
+
+		var data map[string]interface{}
+		decodeBody(t, res, &data)
+		assert.Equal(t, "https://issuer.example.com", data["issuer"])
+		assert.Equal(t, "https://auth.example.com/.well-known/jwks.json", data["jwks_uri"])
+		assert.Equal(t, []interface{}{"RS256"}, data["id_token_signing_alg_values_supported"])
+	})
+
+	t.Run("does not advertise HMAC algorithms for ID tokens", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeTokenService()
+		secret, err := token.GeneratePrivateKey(jwa.HS256, 0)
+		require.NoError(t, err)
+		key, err := token.NewKey(secret, &config.Key{Alg: jwa.HS256, KeyID: "hmac"})
+		require.NoError(t, err)
+		require.NoError(t, ts.AddKey(key))
+
+		res := makeDiscoveryRequest(ts, &config.JWK{}, nil)
+
+		var data map[string]interface{}
+		decodeBody(t, res, &data)
+		assert.Equal(t, []interface{}{"RS256"}, data["id_token_signing_alg_values_supported"])
+	})
+}
+
+func TestHandleAuthorizationServerMetadata(t *testing.T) {
+	t.Parallel()
+
+	t.Run("describes the OAuth endpoints", func(t *testing.T) {
+		t.Parallel()
+
+		res := makeDiscoveryRequestWithPath(makeTokenService(), &config.JWK{}, "/.well-known/oauth-authorization-server", nil)
+
+		var data map[string]interface{}
+		decodeBody(t, res, &data)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "http://localhost:8080", data["issuer"])
+		assert.Equal(t, "http://localhost:8080/.well-known/jwks.json", data["jwks_uri"])
+		assert.Equal(t, "http://localhost:8080/oauth/introspect", data["introspection_endpoint"])
+		assert.Equal(t, "http://localhost:8080/oauth/revoke", data["revocation_endpoint"])
+		assert.Equal(t, "http://localhost:8080/oauth/token", data["token_endpoint"])
+		assert.Equal(t, "http://localhost:8080/authorize", data["authorization_endpoint"])
+		assert.Equal(t, []interface{}{"code"}, data["response_types_supported"])
+		assert.Equal(t, []interface{}{"authorization_code", "client_credentials", "refresh_token", "password"}, data["grant_types_supported"])
+		assert.Equal(t, []interface{}{"client_secret_basic", "client_secret_post", "none"}, data["token_endpoint_auth_methods_supported"])
+		assert.Equal(t, []interface{}{"S256", "plain"}, data["code_challenge_methods_supported"])
+		assert.NotContains(t, data, "id_token_signing_alg_values_supported")
+		assert.NotContains(t, data, "userinfo_endpoint")
+	})
+
+	t.Run("appends the tenant to the issuer and the endpoints", func(t *testing.T) {
+		t.Parallel()
+
+		for _, issuer := range []string{"", "https://issuer.example.com", "https://issuer.example.com/"} {
+			cfg := &config.JWK{Claims: config.Claims{Issuer: issuer}}
+			res := makeDiscoveryRequestWithPath(makeTokenService(), cfg, "/.well-known/oauth-authorization-server/acme", nil)
+
+			var data map[string]interface{}
+			decodeBody(t, res, &data)
+
+			expected := "https://issuer.example.com/acme"
+			if issuer == "" {
+				expected = "http://localhost:8080/acme"
+			}
+			assert.Equal(t, expected, data["issuer"])
+			assert.Equal(t, "http://localhost:8080/acme/oauth/token", data["token_endpoint"])
+			assert.Equal(t, "http://localhost:8080/acme/authorize", data["authorization_endpoint"])
+			assert.Equal(t, "http://localhost:8080/.well-known/jwks.json", data["jwks_uri"])
+		}
+	})
+
+	t.Run("does not serve nested tenant paths", func(t *testing.T) {
+		t.Parallel()
+
+		res := makeDiscoveryRequestWithPath(makeTokenService(), &config.JWK{}, "/.well-known/oauth-authorization-server/a/b", nil)
+		res.Body.Close()
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+}
@@ -2,23 +2,50 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
 	"net/http"
+	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/murar8/local-jwks-server/internal/config"
+	"github.com/murar8/local-jwks-server/internal/revocation"
 	"github.com/murar8/local-jwks-server/internal/token"
 )
 
+// ErrAmbiguousSignRequest is returned when a sign request body has a header
+// field but is not an envelope made of exactly a header and a claims object.
+var ErrAmbiguousSignRequest = errors.New("ambiguous sign request: expected only a header and a claims object")
+
 type Handler interface {
 	HandleJWKS(w http.ResponseWriter, r *http.Request)
 	HandleSign(w http.ResponseWriter, r *http.Request)
+	HandleSignProfile(w http.ResponseWriter, r *http.Request)
+	HandleVerify(w http.ResponseWriter, r *http.Request)
+}
+
+// VerifyRequest describes a token to verify. The iss and aud claims are only
+// validated if the expected values are provided, and Skew defaults to the
+// server configuration.
+type VerifyRequest struct {
+	Token    string           `json:"token"`
+	Issuer   string           `json:"iss"`
+	Audience string           `json:"aud"`
+	Skew     *config.Duration `json:"skew"`
 }
 
 type handler struct {
 	tokenService token.Service
+	revocations  *revocation.Store
+	cfg          *config.JWK
 }
 
-func New(tokenService token.Service) Handler {
-	return &handler{tokenService}
+func New(tokenService token.Service, revocations *revocation.Store, cfg *config.JWK) Handler {
+	return &handler{tokenService, revocations, cfg}
 }
 
 func (h *handler) HandleJWKS(w http.ResponseWriter, r *http.Request) {
@@ -30,15 +57,138 @@ func (h *handler) HandleJWKS(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// HandleSign signs a token with the claims in the request body. The body can
+// also be an envelope of the form {"header": {}, "claims": {}} to customize
+// the protected header.
 func (h *handler) HandleSign(w http.ResponseWriter, r *http.Request) {
-	var payload map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+	payload, header, err := decodeSignRequest(r)
+	if err != nil {
+		renderSignRequestError(w, r, err)
+		return
+	}
+
+	h.sign(w, r, payload, token.WithHeaders(header))
+}
+
+// HandleSignProfile signs a token using the claims of a profile, overridden by
+// the claims in the request body. The body can be omitted.
+func (h *handler) HandleSignProfile(w http.ResponseWriter, r *http.Request) {
+	profile, ok := h.cfg.Profiles[chi.URLParam(r, "profile")]
+	if !ok {
+		res := &ErrorResponse{Error: "profile not found", StatusCode: http.StatusNotFound}
+		render.Render(w, r, res)
+		return
+	}
+
+	payload, header, err := decodeSignRequest(r)
+	if err != nil && !errors.Is(err, io.EOF) {
+		renderSignRequestError(w, r, err)
+		return
+	}
+
+	claims := merge(profile.Claims, payload)
+	opts := []token.SignOption{
+		token.WithKeyID(profile.KeyID),
+		token.WithAlgorithm(profile.Alg),
+		token.WithHeaders(merge(profile.Headers, header)),
+	}
+	if profile.TTL != nil {
+		opts = append(opts, token.WithTTL(time.Duration(*profile.TTL)))
+	}
+
+	h.sign(w, r, claims, opts...)
+}
+
+// HandleVerify verifies a token against the keys of the server. Invalid tokens
+// are reported in the response body rather than with an error status.
+func (h *handler) HandleVerify(w http.ResponseWriter, r *http.Request) {
+	var req VerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		res := &ErrorResponse{Error: err.Error(), StatusCode: http.StatusUnprocessableEntity}
 		render.Render(w, r, res)
 		return
 	}
 
-	signed, err := h.tokenService.SignToken(payload)
+	if req.Token == "" {
+		res := &ErrorResponse{Error: "missing token", StatusCode: http.StatusUnprocessableEntity}
+		render.Render(w, r, res)
+		return
+	}
+
+	skew := h.cfg.VerifySkew
+	if req.Skew != nil {
+		skew = time.Duration(*req.Skew)
+	}
+
+	opts := []token.VerifyOption{
+		token.WithSkew(skew),
+		token.WithIssuer(req.Issuer),
+		token.WithAudience(req.Audience),
+		token.WithRevocationList(h.revocations),
+	}
+
+	render.JSON(w, r, h.tokenService.VerifyToken([]byte(req.Token), opts...))
+}
+
+// decodeSignRequest decodes the claims and the optional protected header of a
+// sign request. The body is an envelope when it has a header field, in which
+// case it must contain exactly a header and a claims object. Otherwise the
+// whole body holds the claims.
+func decodeSignRequest(r *http.Request) (map[string]interface{}, map[string]interface{}, error) {
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, nil, fmt.Errorf("invalid request body: %w", err)
+	}
+
+	if _, hasHeader := body["header"]; !hasHeader {
+		return body, nil, nil
+	}
+
+	header, isHeader := body["header"].(map[string]interface{})
+	claims, isClaims := body["claims"].(map[string]interface{})
+	if !isHeader || !isClaims || len(body) != 2 {
+		return nil, nil, ErrAmbiguousSignRequest
+	}
+
+	return claims, header, nil
+}
+
+// renderSignRequestError renders the error of an undecodable sign request.
+func renderSignRequestError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusUnprocessableEntity
+	if errors.Is(err, ErrAmbiguousSignRequest) {
+		status = http.StatusBadRequest
+	}
+
+	render.Render(w, r, &ErrorResponse{Error: err.Error(), StatusCode: status})
+}
+
+// merge returns a copy of base with the values of override applied over it.
+func merge(base, override map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{}, len(base)+len(override))
+	maps.Copy(res, base)
+	maps.Copy(res, override)
+
+	return res
+}
+
+// sign signs the payload and renders the token. The kid and alg query
+// parameters take precedence over the provided options.
+func (h *handler) sign(
+	w http.ResponseWriter,
+	r *http.Request,
+	payload map[string]interface{},
+	opts ...token.SignOption,
+) {
+	query := r.URL.Query()
+	if query.Has("kid") {
+		opts = append(opts, token.WithKeyID(query.Get("kid")))
+	}
+	if query.Has("alg") {
+		opts = append(opts, token.WithAlgorithm(jwa.SignatureAlgorithm(query.Get("alg"))))
+	}
+
+	signed, err := h.tokenService.SignToken(payload, opts...)
 	if err != nil {
 		res := &ErrorResponse{Error: err.Error(), StatusCode: http.StatusBadRequest}
 		render.Render(w, r, res)
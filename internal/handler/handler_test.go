@@ -4,14 +4,20 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/lestrrat-go/jwx/v2/jwa"
 	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
 	"github.com/lestrrat-go/jwx/v2/jwt"
 	"github.com/murar8/local-jwks-server/internal/config"
 	"github.com/murar8/local-jwks-server/internal/handler"
+	"github.com/murar8/local-jwks-server/internal/revocation"
 	"github.com/murar8/local-jwks-server/internal/token"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -23,14 +29,42 @@ func (f *failingTokenService) GetKey() jwk.Key {
 	return nil
 }
 
+func (f *failingTokenService) GetKeys() []jwk.Key {
+	return nil
+}
+
 func (f *failingTokenService) GetKeySet() (jwk.Set, error) {
 	return nil, errors.New("failed to build key set")
 }
 
-func (f *failingTokenService) SignToken(map[string]interface{}) ([]byte, error) {
+func (f *failingTokenService) FindKey(string, jwa.SignatureAlgorithm) (jwk.Key, error) {
+	return nil, token.ErrKeyNotFound
+}
+
+func (f *failingTokenService) SignToken(map[string]interface{}, ...token.SignOption) ([]byte, error) {
 	return nil, errors.New("failed to sign token")
 }
 
+func (f *failingTokenService) VerifyToken([]byte, ...token.VerifyOption) *token.Verification {
+	return &token.Verification{}
+}
+
+func (f *failingTokenService) AddKey(jwk.Key) error {
+	return errors.New("failed to add key")
+}
+
+func (f *failingTokenService) ReplaceKey(jwk.Key) error {
+	return errors.New("failed to replace key")
+}
+
+func (f *failingTokenService) RemoveKey(string) error {
+	return errors.New("failed to remove key")
+}
+
+func (f *failingTokenService) SetDefaultKey(string) error {
+	return errors.New("failed to set default key")
+}
+
 func makeTokenService() token.Service {
 	cfg := config.JWK{Alg: "RS256", KeyOps: jwk.KeyOperationList{"sign", "verify"}}
 	raw, _ := token.GeneratePrivateKey(cfg.Alg, 2048)
@@ -38,23 +72,40 @@ func makeTokenService() token.Service {
 	return ts
 }
 
+func makeMultiKeyTokenService() token.Service {
+	var keys []jwk.Key
+
+	for _, cfg := range []config.Key{{Alg: "RS256", KeyID: "rsa"}, {Alg: "ES256", KeyID: "ec"}} {
+		raw, _ := token.GeneratePrivateKey(cfg.Alg, 2048)
+		key, _ := token.NewKey(raw, &cfg)
+		keys = append(keys, key)
+	}
+
+	ts, _ := token.New(keys, &config.JWK{})
+	return ts
+}
+
 func makeHandleJWKSRequest(ts token.Service) *http.Response {
 	req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
 	w := httptest.NewRecorder()
-	h := handler.New(ts)
+	h := handler.New(ts, revocation.New(), &config.JWK{})
 	h.HandleJWKS(w, req)
 	return w.Result()
 }
 
 func makeHandleSignRequest(ts token.Service, payload interface{}) *http.Response {
+	return makeHandleSignRequestWithQuery(ts, payload, "")
+}
+
+func makeHandleSignRequestWithQuery(ts token.Service, payload interface{}, query string) *http.Response {
 	body, err := json.Marshal(payload)
 	if err != nil {
 		panic(err)
 	}
 
-	req := httptest.NewRequest(http.MethodPost, "/jwt/sign", bytes.NewReader(body))
+	req := httptest.NewRequest(http.MethodPost, "/jwt/sign"+query, bytes.NewReader(body))
 	w := httptest.NewRecorder()
-	h := handler.New(ts)
+	h := handler.New(ts, revocation.New(), &config.JWK{})
 	h.HandleSign(w, req)
 	return w.Result()
 }
@@ -79,6 +130,40 @@ func TestHandleJWKS(t *testing.T) {
 		assert.Equal(t, "RS256", data["keys"][0]["alg"])
 	})
 
+	t.Run(("serializes every key in the set"), func(t *testing.T) {
+		t.Parallel()
+
+		res := makeHandleJWKSRequest(makeMultiKeyTokenService())
+
+		var data map[string][]map[string]interface{}
+		err := json.NewDecoder(res.Body).Decode(&data)
+		res.Body.Close()
+
+		require.NoError(t, err)
+		require.Len(t, data["keys"], 2)
+		assert.Equal(t, "rsa", data["keys"][0]["kid"])
+		assert.Equal(t, "ec", data["keys"][1]["kid"])
+		assert.Equal(t, "EC", data["keys"][1]["kty"])
+	})
+
+	t.Run(("serializes EdDSA keys with their curve"), func(t *testing.T) {
+		t.Parallel()
+
+		cfg := config.JWK{Alg: jwa.EdDSA}
+		raw, _ := token.GeneratePrivateKey(cfg.Alg, 0)
+		ts, _ := token.FromRawKey(raw, &cfg)
+		res := makeHandleJWKSRequest(ts)
+
+		var data map[string][]map[string]interface{}
+		err := json.NewDecoder(res.Body).Decode(&data)
+		res.Body.Close()
+
+		require.NoError(t, err)
+		assert.Equal(t, "OKP", data["keys"][0]["kty"])
+		assert.Equal(t, "Ed25519", data["keys"][0]["crv"])
+		assert.Equal(t, "EdDSA", data["keys"][0]["alg"])
+	})
+
 	t.Run(("returns an error if the key set cannot be generated"), func(t *testing.T) {
 		t.Parallel()
 
@@ -127,6 +212,37 @@ func TestHandleSign(t *testing.T) {
 		assert.Equal(t, "value", parsed.PrivateClaims()["custom"])
 	})
 
+	t.Run(("signs with the key selected by the query parameters"), func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeMultiKeyTokenService()
+
+		for _, query := range []string{"?kid=ec", "?alg=ES256", "?kid=ec&alg=ES256"} {
+			res := makeHandleSignRequestWithQuery(ts, map[string]interface{}{"sub": "john_doe"}, query)
+
+			var data map[string]interface{}
+			err := json.NewDecoder(res.Body).Decode(&data)
+			res.Body.Close()
+
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+			msg, err := jws.Parse([]byte(data["jwt"].(string)))
+			require.NoError(t, err)
+			assert.Equal(t, "ec", msg.Signatures()[0].ProtectedHeaders().KeyID())
+			assert.Equal(t, jwa.ES256, msg.Signatures()[0].ProtectedHeaders().Algorithm())
+		}
+	})
+
+	t.Run(("returns bad request status if the selected key does not exist"), func(t *testing.T) {
+		t.Parallel()
+
+		res := makeHandleSignRequestWithQuery(makeMultiKeyTokenService(), map[string]interface{}{}, "?kid=missing")
+		res.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
 	t.Run(("returns bad request status if the payload is invalid"), func(t *testing.T) {
 		t.Parallel()
 
@@ -153,3 +269,289 @@ func TestHandleSign(t *testing.T) {
 		assert.NotNil(t, data["error"])
 	})
 }
+
+func makeHandleSignProfileRequest(ts token.Service, profile string, payload interface{}, query string) *http.Response {
+	var body io.Reader = http.NoBody
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			panic(err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	ttl := config.Duration(0)
+	cfg := &config.JWK{
+		Claims: config.Claims{TTL: time.Hour},
+		Profiles: map[string]config.Profile{
+			"admin": {
+				Claims:  map[string]interface{}{"sub": "admin", "role": "admin"},
+				Headers: map[string]interface{}{"typ": "at+jwt"},
+				KeyID:   "ec",
+				TTL:     &ttl,
+			},
+		},
+	}
+
+	h := handler.New(ts, revocation.New(), cfg)
+	router := chi.NewRouter()
+	router.Post("/jwt/sign/{profile}", h.HandleSignProfile)
+
+	req := httptest.NewRequest(http.MethodPost, "/jwt/sign/"+profile+query, body)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Result()
+}
+
+func TestHandleSignProfile(t *testing.T) {
+	t.Parallel()
+
+	t.Run("signs a token using the profile", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeMultiKeyTokenService()
+		res := makeHandleSignProfileRequest(ts, "admin", nil, "")
+
+		var data map[string]interface{}
+		decodeBody(t, res, &data)
+		assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+		msg, err := jws.Parse([]byte(data["jwt"].(string)))
+		require.NoError(t, err)
+		headers := msg.Signatures()[0].ProtectedHeaders()
+		assert.Equal(t, "ec", headers.KeyID())
+		assert.Equal(t, "at+jwt", headers.Type())
+
+		parsed, err := jwt.Parse([]byte(data["jwt"].(string)), jwt.WithVerify(false))
+		require.NoError(t, err)
+		assert.Equal(t, "admin", parsed.Subject())
+		assert.Equal(t, "admin", parsed.PrivateClaims()["role"])
+		assert.True(t, parsed.Expiration().IsZero())
+	})
+
+	t.Run("merges the request body over the profile claims", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeMultiKeyTokenService()
+		res := makeHandleSignProfileRequest(ts, "admin", map[string]interface{}{"sub": "jane"}, "?kid=rsa")
+
+		var data map[string]interface{}
+		decodeBody(t, res, &data)
+		assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+		msg, err := jws.Parse([]byte(data["jwt"].(string)))
+		require.NoError(t, err)
+		assert.Equal(t, "rsa", msg.Signatures()[0].ProtectedHeaders().KeyID())
+
+		parsed, err := jwt.Parse([]byte(data["jwt"].(string)), jwt.WithVerify(false))
+		require.NoError(t, err)
+		assert.Equal(t, "jane", parsed.Subject())
+		assert.Equal(t, "admin", parsed.PrivateClaims()["role"])
+	})
+
+	t.Run("returns not found status if the profile does not exist", func(t *testing.T) {
+		t.Parallel()
+
+		res := makeHandleSignProfileRequest(makeMultiKeyTokenService(), "missing", nil, "")
+
+		var data map[string]interface{}
+		decodeBody(t, res, &data)
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+		assert.Equal(t, "profile not found", data["error"])
+	})
+
+	t.Run("returns unprocessable entity status if the payload is malformed", func(t *testing.T) {
+		t.Parallel()
+
+		res := makeHandleSignProfileRequest(makeMultiKeyTokenService(), "admin", "invalid", "")
+		res.Body.Close()
+
+		assert.Equal(t, http.StatusUnprocessableEntity, res.StatusCode)
+	})
+}
+
+func TestHandleSignHeader(t *testing.T) {
+	t.Parallel()
+
+	t.Run("adds the header of an envelope request", func(t *testing.T) {
+		t.Parallel()
+
+		payload := map[string]interface{}{
+			"header": map[string]interface{}{"typ": "at+jwt", "x5u": "https://example.com/cert.pem", "kid": "ec"},
+			"claims": map[string]interface{}{"sub": "john_doe"},
+		}
+		res := makeHandleSignRequest(makeMultiKeyTokenService(), payload)
+
+		var data map[string]interface{}
+		decodeBody(t, res, &data)
+		assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+		msg, err := jws.Parse([]byte(data["jwt"].(string)))
+		require.NoError(t, err)
+		headers := msg.Signatures()[0].ProtectedHeaders()
+		assert.Equal(t, "at+jwt", headers.Type())
+		assert.Equal(t, "https://example.com/cert.pem", headers.X509URL())
+		assert.Equal(t, "ec", headers.KeyID())
+
+		parsed, err := jwt.Parse(msg.Payload(), jwt.WithVerify(false))
+		require.NoError(t, err)
+		assert.Equal(t, "john_doe", parsed.Subject())
+		_, hasHeader := parsed.Get("header")
+		assert.False(t, hasHeader)
+	})
+
+	t.Run("treats other bodies as claims", func(t *testing.T) {
+		t.Parallel()
+
+		payload := map[string]interface{}{"sub": "john_doe", "claims": map[string]interface{}{"role": "admin"}}
+		res := makeHandleSignRequest(makeTokenService(), payload)
+
+		var data map[string]interface{}
+		decodeBody(t, res, &data)
+		assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+		parsed, err := jwt.Parse([]byte(data["jwt"].(string)), jwt.WithVerify(false))
+		require.NoError(t, err)
+		assert.Equal(t, "john_doe", parsed.Subject())
+		assert.Equal(t, map[string]interface{}{"role": "admin"}, parsed.PrivateClaims()["claims"])
+	})
+
+	t.Run("treats a single claims object as claims", func(t *testing.T) {
+		t.Parallel()
+
+		payload := map[string]interface{}{"claims": map[string]interface{}{"sub": "john_doe"}}
+		res := makeHandleSignRequest(makeTokenService(), payload)
+
+		var data map[string]interface{}
+		decodeBody(t, res, &data)
+		assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+		parsed, err := jwt.Parse([]byte(data["jwt"].(string)), jwt.WithVerify(false))
+		require.NoError(t, err)
+		assert.Empty(t, parsed.Subject())
+		assert.Equal(t, map[string]interface{}{"sub": "john_doe"}, parsed.PrivateClaims()["claims"])
+	})
+
+	t.Run("returns bad request status for ambiguous bodies", func(t *testing.T) {
+		t.Parallel()
+
+		payloads := []map[string]interface{}{
+			{"header": map[string]interface{}{"typ": "at+jwt"}, "sub": "john_doe"},
+			{
+				"header": map[string]interface{}{"typ": "at+jwt"},
+				"claims": map[string]interface{}{"sub": "john_doe"},
+				"aud":    "api",
+			},
+			{"header": "at+jwt", "claims": map[string]interface{}{"sub": "john_doe"}},
+		}
+
+		for _, payload := range payloads {
+			res := makeHandleSignRequest(makeTokenService(), payload)
+
+			var data map[string]interface{}
+			decodeBody(t, res, &data)
+			assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+			assert.Equal(t, handler.ErrAmbiguousSignRequest.Error(), data["error"])
+		}
+	})
+
+	t.Run("returns bad request status if the header conflicts with the key", func(t *testing.T) {
+		t.Parallel()
+
+		payload := map[string]interface{}{
+			"header": map[string]interface{}{"alg": "ES256"},
+			"claims": map[string]interface{}{"sub": "john_doe"},
+		}
+		res := makeHandleSignRequestWithQuery(makeMultiKeyTokenService(), payload, "?kid=rsa")
+
+		var data map[string]interface{}
+		decodeBody(t, res, &data)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+		assert.Equal(t, `header conflicts with the signing key: alg is ES256 but the key requires "RS256"`, data["error"])
+	})
+}
+
+func makeHandleVerifyRequest(ts token.Service, payload interface{}) *http.Response {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		panic(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/jwt/verify", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	h := handler.New(ts, revocation.New(), &config.JWK{VerifySkew: time.Minute})
+	h.HandleVerify(w, req)
+	return w.Result()
+}
+
+func TestHandleVerify(t *testing.T) {
+	t.Parallel()
+
+	t.Run("returns the decoded token if it is valid", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeTokenService()
+		signed, err := ts.SignToken(map[string]interface{}{"sub": "john_doe", "iss": "issuer"})
+		require.NoError(t, err)
+
+		res := makeHandleVerifyRequest(ts, map[string]interface{}{"token": string(signed), "iss": "issuer"})
+
+		var data map[string]interface{}
+		decodeBody(t, res, &data)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, true, data["valid"])
+		assert.Equal(t, "RS256", data["header"].(map[string]interface{})["alg"])
+		assert.Equal(t, "john_doe", data["claims"].(map[string]interface{})["sub"])
+		assert.NotContains(t, data, "failures")
+	})
+
+	t.Run("returns the failed checks if the token is invalid", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeTokenService()
+		signed, err := ts.SignToken(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()})
+		require.NoError(t, err)
+
+		res := makeHandleVerifyRequest(ts, map[string]interface{}{"token": string(signed), "aud": "api"})
+
+		var data map[string]interface{}
+		decodeBody(t, res, &data)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, false, data["valid"])
+
+		failures := data["failures"].([]interface{})
+		require.Len(t, failures, 2)
+		assert.Equal(t, "exp", failures[0].(map[string]interface{})["check"])
+		assert.Equal(t, "aud", failures[1].(map[string]interface{})["check"])
+	})
+
+	t.Run("applies the configured skew unless overridden", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeTokenService()
+		signed, err := ts.SignToken(map[string]interface{}{"exp": time.Now().Add(-30 * time.Second).Unix()})
+		require.NoError(t, err)
+
+		for skew, valid := range map[string]bool{"": true, "0s": false} {
+			payload := map[string]interface{}{"token": string(signed)}
+			if skew != "" {
+				payload["skew"] = skew
+			}
+
+			var data map[string]interface{}
+			decodeBody(t, makeHandleVerifyRequest(ts, payload), &data)
+			assert.Equal(t, valid, data["valid"])
+		}
+	})
+
+	t.Run("returns unprocessable entity status if the token is missing", func(t *testing.T) {
+		t.Parallel()
+
+		res := makeHandleVerifyRequest(makeTokenService(), map[string]interface{}{})
+
+		var data map[string]interface{}
+		decodeBody(t, res, &data)
+		assert.Equal(t, http.StatusUnprocessableEntity, res.StatusCode)
+		assert.Equal(t, "missing token", data["error"])
+	})
+}
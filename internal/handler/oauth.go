@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"html/template"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/murar8/local-jwks-server/internal/authcode"
+	"github.com/murar8/local-jwks-server/internal/config"
+	"github.com/murar8/local-jwks-server/internal/refresh"
+	"github.com/murar8/local-jwks-server/internal/revocation"
+	"github.com/murar8/local-jwks-server/internal/token"
+)
+
+type OAuthHandler interface {
+	HandleAuthorize(w http.ResponseWriter, r *http.Request)
+	HandleAuthorizeLogin(w http.ResponseWriter, r *http.Request)
+	HandleToken(w http.ResponseWriter, r *http.Request)
+	HandleIntrospect(w http.ResponseWriter, r *http.Request)
+	HandleRevoke(w http.ResponseWriter, r *http.Request)
+	HandleUserInfo(w http.ResponseWriter, r *http.Request)
+}
+
+type oauthHandler struct {
+	tokenService  token.Service
+	revocations   *revocation.Store
+	codes         *authcode.Store
+	refreshTokens *refresh.Store
+	cfg           *config.Config
+	loginPage     *template.Template
+}
+
+func NewOAuth(
+	tokenService token.Service,
+	revocations *revocation.Store,
+	codes *authcode.Store,
+	refreshTokens *refresh.Store,
+	cfg *config.Config,
+) OAuthHandler {
+	loginPage := template.Must(template.New("login").Parse(loginPageTemplate))
+	return &oauthHandler{tokenService, revocations, codes, refreshTokens, cfg, loginPage}
+}
+
+// HandleIntrospect implements RFC 7662 token introspection. Active tokens are
+// described by their claims, while any token failing verification is only
+// reported as inactive.
+func (h *oauthHandler) HandleIntrospect(w http.ResponseWriter, r *http.Request) {
+	signed, ok := formToken(w, r)
+	if !ok {
+		return
+	}
+
+	v := h.tokenService.VerifyToken(
+		[]byte(signed),
+		token.WithSkew(h.cfg.JWK.VerifySkew),
+		token.WithRevocationList(h.revocations),
+	)
+	if !v.Valid {
+		render.JSON(w, r, map[string]interface{}{"active": false})
+		return
+	}
+
+	render.JSON(w, r, newIntrospectionResponse(v.Claims))
+}
+
+// HandleRevoke implements RFC 7009 token revocation. Tokens are revoked by
+// their jti claim until they expire, while refresh tokens are revoked along
+// with the refresh tokens obtained by rotating them. As required by the RFC,
+// tokens that are invalid, were not issued by this server or have no jti are
+// ignored.
+func (h *oauthHandler) HandleRevoke(w http.ResponseWriter, r *http.Request) {
+	signed, ok := formToken(w, r)
+	if !ok {
+		return
+	}
+
+	if h.refreshTokens.Revoke(signed) {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	v := h.tokenService.VerifyToken([]byte(signed))
+	if slices.ContainsFunc(v.Failures, isIssuerFailure) {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Tokens without a jti cannot be revoked, which RFC 7009 treats like an
+	// invalid token.
+	jti, _ := v.Claims["jti"].(string)
+	if jti == "" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var exp time.Time
+	if seconds, isNumber := v.Claims["exp"].(float64); isNumber {
+		exp = time.Unix(int64(seconds), 0)
+	}
+
+	h.revocations.Revoke(jti, exp)
+	w.WriteHeader(http.StatusOK)
+}
+
+// isIssuerFailure reports whether the token was not issued by this server.
+func isIssuerFailure(f token.VerificationFailure) bool {
+	return f.Check == "format" || f.Check == "signature"
+}
+
+// formToken returns the token parameter of a form-encoded request, rendering
+// an error if it is missing.
+func formToken(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if err := r.ParseForm(); err != nil {
+		oauthError(w, r, errInvalidRequest, err.Error())
+		return "", false
+	}
+
+	signed := r.PostForm.Get("token")
+	if signed == "" {
+		oauthError(w, r, errInvalidRequest, "missing token")
+		return "", false
+	}
+
+	return signed, true
+}
+
+// newIntrospectionResponse maps the claims of an active token to the RFC 7662
+// response members. The client_id defaults to the authorized party and list
+// scopes are joined with spaces.
+func newIntrospectionResponse(claims map[string]interface{}) map[string]interface{} {
+	res := merge(claims, map[string]interface{}{"active": true, "token_type": "Bearer"})
+
+	if _, exists := res["client_id"]; !exists {
+		if azp, ok := claims["azp"]; ok {
+			res["client_id"] = azp
+		}
+	}
+
+	if scopes, ok := claims["scope"].([]interface{}); ok {
+		parts := make([]string, 0, len(scopes))
+		for _, scope := range scopes {
+			if s, isString := scope.(string); isString {
+				parts = append(parts, s)
+			}
+		}
+		res["scope"] = strings.Join(parts, " ")
+	}
+
+	return res
+}
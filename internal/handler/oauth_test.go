@@ -0,0 +1,203 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/murar8/local-jwks-server/internal/authcode"
+	"github.com/murar8/local-jwks-server/internal/config"
+	"github.com/murar8/local-jwks-server/internal/handler"
+	"github.com/murar8/local-jwks-server/internal/refresh"
+	"github.com/murar8/local-jwks-server/internal/revocation"
+	"github.com/murar8/local-jwks-server/internal/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeOAuthRequest(ts token.Service, method, path string, form url.Values) *http.Response {
+	return makeOAuthRequestWithStore(ts, revocation.New(), method, path, form)
+}
+
+func makeOAuthRequestWithStore(ts token.Service, revocations *revocation.Store, method, path string, form url.Values) *http.Response {
+	return serveOAuthRequest(ts, revocations, newFormRequest(method, path, form))
+}
+
+func newFormRequest(method, path string, form url.Values) *http.Request {
+	req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
+
+func serveOAuthRequest(ts token.Service, revocations *revocation.Store, req *http.Request) *http.Response {
+	w := httptest.NewRecorder()
+	newOAuthRouter(ts, revocations, authcode.New(time.Minute), refresh.New(time.Hour), true).ServeHTTP(w, req)
+	return w.Result()
+}
+
+func newOAuthRouter(
+	ts token.Service,
+	revocations *revocation.Store,
+	codes *authcode.Store,
+	refreshTokens *refresh.Store,
+	rotation bool,
+) http.Handler {
+	cfg := &config.Config{
+		JWK: config.JWK{Claims: config.Claims{TTL: time.Hour}},
+		OAuth: config.OAuth{
+			RefreshTokenTTL:      time.Hour,
+			RefreshTokenRotation: rotation,
+			Clients: []config.Client{
+				{
+					ID:           "service",
+					Secret:       "s3cr3t:/",
+					Scopes:       []string{"read", "write"},
+					Audience:     []string{"api"},
+					RedirectURIs: []string{"https://app.example.com/callback"},
+				},
+				{ID: "public", RedirectURIs: []string{"http://localhost:3000/callback?app=spa"}},
+			},
+			Users: []config.User{
+				{Subject: "alice", Username: "alice", Password: "wonderland", Claims: map[string]interface{}{"name": "Alice"}},
+				{Subject: "bob"},
+			},
+		},
+	}
+
+	h := handler.NewOAuth(ts, revocations, codes, refreshTokens, cfg)
+	router := chi.NewRouter()
+	for _, prefix := range []string{"", "/{tenant}"} {
+		router.Get(prefix+"/authorize", h.HandleAuthorize)
+		router.Post(prefix+"/authorize", h.HandleAuthorizeLogin)
+		router.Post(prefix+"/oauth/token", h.HandleToken)
+		router.Post(prefix+"/oauth/introspect", h.HandleIntrospect)
+		router.Post(prefix+"/oauth/revoke", h.HandleRevoke)
+		router.Get(prefix+"/userinfo", h.HandleUserInfo)
+		router.Post(prefix+"/userinfo", h.HandleUserInfo)
+	}
+
+	return router
+}
+
+func TestHandleIntrospect(t *testing.T) {
+	t.Parallel()
+
+	t.Run("describes an active token", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeTokenService()
+		payload := map[string]interface{}{
+			"sub":   "john_doe",
+			"azp":   "my-client",
+			"scope": []string{"read", "write"},
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		}
+		signed, err := ts.SignToken(payload)
+		require.NoError(t, err)
+
+		res := makeOAuthRequest(ts, http.MethodPost, "/oauth/introspect", url.Values{"token": {string(signed)}})
+
+		var data map[string]interface{}
+		decodeBody(t, res, &data)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, true, data["active"])
+		assert.Equal(t, "john_doe", data["sub"])
+		assert.Equal(t, "my-client", data["client_id"])
+		assert.Equal(t, "read write", data["scope"])
+		assert.Equal(t, "Bearer", data["token_type"])
+		assert.EqualValues(t, payload["exp"], data["exp"])
+	})
+
+	t.Run("reports an expired token as inactive", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeTokenService()
+		signed, err := ts.SignToken(map[string]interface{}{"sub": "john_doe", "exp": time.Now().Add(-time.Hour).Unix()})
+		require.NoError(t, err)
+
+		res := makeOAuthRequest(ts, http.MethodPost, "/oauth/introspect", url.Values{"token": {string(signed)}})
+
+		var data map[string]interface{}
+		decodeBody(t, res, &data)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, map[string]interface{}{"active": false}, data)
+	})
+
+	t.Run("reports a malformed token as inactive", func(t *testing.T) {
+		t.Parallel()
+
+		res := makeOAuthRequest(makeTokenService(), http.MethodPost, "/oauth/introspect", url.Values{"token": {"invalid"}})
+
+		var data map[string]interface{}
+		decodeBody(t, res, &data)
+		assert.Equal(t, map[string]interface{}{"active": false}, data)
+	})
+
+	t.Run("returns an invalid request error if the token is missing", func(t *testing.T) {
+		t.Parallel()
+
+		res := makeOAuthRequest(makeTokenService(), http.MethodPost, "/oauth/introspect", url.Values{})
+
+		var data map[string]interface{}
+		decodeBody(t, res, &data)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+		assert.Equal(t, "invalid_request", data["error"])
+		assert.Equal(t, "missing token", data["error_description"])
+	})
+}
+
+func TestHandleRevoke(t *testing.T) {
+	t.Parallel()
+
+	t.Run("revokes the token until it expires", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeTokenService()
+		revocations := revocation.New()
+		signed, err := ts.SignToken(map[string]interface{}{"jti": "token-id", "exp": time.Now().Add(time.Hour).Unix()})
+		require.NoError(t, err)
+		form := url.Values{"token": {string(signed)}}
+
+		res := makeOAuthRequestWithStore(ts, revocations, http.MethodPost, "/oauth/revoke", form)
+		res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.True(t, revocations.IsRevoked("token-id"))
+
+		res = makeOAuthRequestWithStore(ts, revocations, http.MethodPost, "/oauth/introspect", form)
+
+		var data map[string]interface{}
+		decodeBody(t, res, &data)
+		assert.Equal(t, map[string]interface{}{"active": false}, data)
+	})
+
+	t.Run("ignores tokens not issued by the server", func(t *testing.T) {
+		t.Parallel()
+
+		signed, err := makeTokenService().SignToken(map[string]interface{}{"jti": "token-id"})
+		require.NoError(t, err)
+
+		revocations := revocation.New()
+		res := makeOAuthRequestWithStore(makeTokenService(), revocations, http.MethodPost, "/oauth/revoke", url.Values{"token": {string(signed)}})
+		res.Body.Close()
+
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.False(t, revocations.IsRevoked("token-id"))
+	})
+
+	t.Run("ignores tokens without a jti", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeTokenService()
+		signed, err := ts.SignToken(map[string]interface{}{"sub": "john_doe"})
+		require.NoError(t, err)
+
+		res := makeOAuthRequest(ts, http.MethodPost, "/oauth/revoke", url.Values{"token": {string(signed)}})
+		res.Body.Close()
+
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	})
+}
@@ -0,0 +1,337 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/murar8/local-jwks-server/internal/config"
+	"github.com/murar8/local-jwks-server/internal/refresh"
+	"github.com/murar8/local-jwks-server/internal/token"
+)
+
+// RFC 6749 and RFC 6750 error codes.
+const (
+	errInvalidRequest       = "invalid_request"
+	errInvalidClient        = "invalid_client"
+	errInvalidGrant         = "invalid_grant"
+	errInvalidScope         = "invalid_scope"
+	errInvalidToken         = "invalid_token"
+	errUnauthorizedClient   = "unauthorized_client"
+	errUnsupportedGrantType = "unsupported_grant_type"
+	errServerError          = "server_error"
+)
+
+func oauthError(w http.ResponseWriter, r *http.Request, code, description string) {
+	statusCode := http.StatusBadRequest
+	switch code {
+	case errInvalidClient, errInvalidToken:
+		statusCode = http.StatusUnauthorized
+	case errServerError:
+		statusCode = http.StatusInternalServerError
+	}
+
+	res := &OAuthErrorResponse{Error: code, Description: description, StatusCode: statusCode}
+	render.Render(w, r, res)
+}
+
+// HandleToken implements the RFC 6749 token endpoint.
+func (h *oauthHandler) HandleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		oauthError(w, r, errInvalidRequest, err.Error())
+		return
+	}
+
+	switch grantType := r.PostForm.Get("grant_type"); grantType {
+	case "client_credentials":
+		h.handleClientCredentials(w, r)
+	case "authorization_code":
+		h.handleAuthorizationCode(w, r)
+	case "refresh_token":
+		h.handleRefreshToken(w, r)
+	case "password":
+		h.handlePassword(w, r)
+	case "":
+		oauthError(w, r, errInvalidRequest, "missing grant_type")
+	default:
+		oauthError(w, r, errUnsupportedGrantType, "unsupported grant type "+grantType)
+	}
+}
+
+func (h *oauthHandler) handleClientCredentials(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+
+	if client.Secret == "" {
+		oauthError(w, r, errUnauthorizedClient, "public clients cannot use the client_credentials grant")
+		return
+	}
+
+	scopes, ok := requestedScopes(r.PostForm.Get("scope"), client.Scopes)
+	if !ok {
+		oauthError(w, r, errInvalidScope, "the requested scope is not allowed for this client")
+		return
+	}
+
+	res, err := h.accessTokenResponse(r, client, map[string]interface{}{"sub": client.ID}, scopes)
+	if err != nil {
+		oauthError(w, r, errServerError, err.Error())
+		return
+	}
+
+	render.Render(w, r, res)
+}
+
+// handleAuthorizationCode redeems an authorization code, verifying the PKCE
+// code verifier. An ID token is issued along with the access token if the
+// openid scope was granted.
+func (h *oauthHandler) handleAuthorizationCode(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+
+	grant, ok := h.codes.Redeem(r.PostForm.Get("code"))
+	if !ok || grant.ClientID != client.ID {
+		oauthError(w, r, errInvalidGrant, "invalid or expired authorization code")
+		return
+	}
+
+	// The redirect URI is only required if it was part of the authorization
+	// request, see RFC 6749 section 4.1.3.
+	if grant.RedirectURI != r.PostForm.Get("redirect_uri") {
+		oauthError(w, r, errInvalidGrant, "redirect_uri does not match the authorization request")
+		return
+	}
+
+	if err := grant.VerifyChallenge(r.PostForm.Get("code_verifier")); err != nil {
+		oauthError(w, r, errInvalidGrant, err.Error())
+		return
+	}
+
+	userGrant := refresh.Grant{ClientID: client.ID, Scopes: grant.Scopes, Claims: grant.Claims, AuthTime: grant.AuthTime}
+
+	res, err := h.userTokenResponse(r, client, &userGrant, grant.Nonce)
+	if err != nil {
+		oauthError(w, r, errServerError, err.Error())
+		return
+	}
+
+	if h.cfg.OAuth.RefreshTokenTTL > 0 {
+		res.RefreshToken = h.refreshTokens.Issue(userGrant)
+	}
+
+	render.Render(w, r, res)
+}
+
+// handleRefreshToken exchanges a refresh token for new tokens. The refresh
+// token is rotated if enabled, and reusing a rotated token revokes all the
+// tokens derived from the same authorization.
+func (h *oauthHandler) handleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+
+	refreshToken := r.PostForm.Get("refresh_token")
+	grant, err := h.refreshTokens.Lookup(refreshToken, client.ID)
+	if err != nil {
+		oauthError(w, r, errInvalidGrant, err.Error())
+		return
+	}
+
+	// The scope can be narrowed down, see RFC 6749 section 6.
+	if scope := r.PostForm.Get("scope"); scope != "" {
+		if grant.Scopes, ok = requestedScopes(scope, grant.Scopes); !ok {
+			oauthError(w, r, errInvalidScope, "the requested scope exceeds the original grant")
+			return
+		}
+	}
+
+	res, err := h.userTokenResponse(r, client, &grant, "")
+	if err != nil {
+		oauthError(w, r, errServerError, err.Error())
+		return
+	}
+
+	// The token is only rotated once the request succeeded, so that a failed
+	// request does not consume it.
+	if h.cfg.OAuth.RefreshTokenRotation {
+		if refreshToken, err = h.refreshTokens.Rotate(refreshToken, client.ID); err != nil {
+			oauthError(w, r, errInvalidGrant, err.Error())
+			return
+		}
+	}
+
+	res.RefreshToken = refreshToken
+	render.Render(w, r, res)
+}
+
+// handlePassword implements the resource owner password credentials grant
+// against the users file.
+func (h *oauthHandler) handlePassword(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+
+	// Users without a password cannot use this grant.
+	user, exists := h.cfg.OAuth.FindUserByUsername(r.PostForm.Get("username"))
+	password := []byte(r.PostForm.Get("password"))
+	if !exists || user.Password == "" || subtle.ConstantTimeCompare([]byte(user.Password), password) != 1 {
+		oauthError(w, r, errInvalidGrant, "invalid username or password")
+		return
+	}
+
+	scopes, ok := authorizeScopes(r.PostForm.Get("scope"), client.Scopes)
+	if !ok {
+		oauthError(w, r, errInvalidScope, "the requested scope is not allowed for this client")
+		return
+	}
+
+	grant := refresh.Grant{
+		ClientID: client.ID,
+		Scopes:   scopes,
+		Claims:   merge(user.Claims, map[string]interface{}{"sub": user.Subject}),
+		AuthTime: time.Now(),
+	}
+
+	res, err := h.userTokenResponse(r, client, &grant, "")
+	if err != nil {
+		oauthError(w, r, errServerError, err.Error())
+		return
+	}
+
+	if h.cfg.OAuth.RefreshTokenTTL > 0 {
+		res.RefreshToken = h.refreshTokens.Issue(grant)
+	}
+
+	render.Render(w, r, res)
+}
+
+// authenticateClient authenticates the client using HTTP basic authentication
+// (client_secret_basic) or the form parameters (client_secret_post). Public
+// clients only need to provide their client_id.
+func (h *oauthHandler) authenticateClient(w http.ResponseWriter, r *http.Request) (*config.Client, bool) {
+	id, secret, isBasic := r.BasicAuth()
+	if isBasic {
+		if r.PostForm.Has("client_secret") {
+			oauthError(w, r, errInvalidRequest, "multiple client authentication methods")
+			return nil, false
+		}
+
+		// Basic credentials are form-encoded, see RFC 6749 section 2.3.1.
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	client, exists := h.cfg.OAuth.FindClient(id)
+	if !exists || subtle.ConstantTimeCompare([]byte(client.Secret), []byte(secret)) != 1 {
+		if isBasic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		oauthError(w, r, errInvalidClient, "client authentication failed")
+		return nil, false
+	}
+
+	return client, true
+}
+
+// requestedScopes validates the space separated scopes against the allowed
+// ones. All the allowed scopes are granted if none is requested.
+func requestedScopes(scope string, allowed []string) ([]string, bool) {
+	requested := strings.Fields(scope)
+	if len(requested) == 0 {
+		return allowed, true
+	}
+
+	for _, s := range requested {
+		if !slices.Contains(allowed, s) {
+			return nil, false
+		}
+	}
+
+	return requested, true
+}
+
+// accessTokenResponse mints an RFC 9068 access token for the identity
+// described by the claims, which must include the subject.
+func (h *oauthHandler) accessTokenResponse(
+	r *http.Request,
+	client *config.Client,
+	identity map[string]interface{},
+	scopes []string,
+) (*TokenResponse, error) {
+	claims := merge(identity, map[string]interface{}{
+		"iss":       issuerURL(r, &h.cfg.JWK),
+		"client_id": client.ID,
+	})
+	if len(scopes) > 0 {
+		claims["scope"] = strings.Join(scopes, " ")
+	}
+	if len(client.Audience) > 0 {
+		claims["aud"] = client.Audience
+	}
+
+	signed, err := h.tokenService.SignToken(claims, token.WithHeaders(map[string]interface{}{"typ": "at+jwt"}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign access token: %w", err)
+	}
+
+	return &TokenResponse{
+		AccessToken: string(signed),
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(h.cfg.JWK.Claims.TTL.Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	}, nil
+}
+
+// userTokenResponse mints the tokens of a grant made on behalf of a user: an
+// access token with the user claims, and an ID token if the openid scope was
+// granted.
+func (h *oauthHandler) userTokenResponse(
+	r *http.Request,
+	client *config.Client,
+	grant *refresh.Grant,
+	nonce string,
+) (*TokenResponse, error) {
+	res, err := h.accessTokenResponse(r, client, grant.Claims, grant.Scopes)
+	if err == nil && slices.Contains(grant.Scopes, "openid") {
+		res.IDToken, err = h.signIDToken(r, client, grant, nonce)
+	}
+
+	return res, err
+}
+
+// signIDToken mints an OpenID Connect ID token for the signed in identity.
+func (h *oauthHandler) signIDToken(
+	r *http.Request,
+	client *config.Client,
+	grant *refresh.Grant,
+	nonce string,
+) (string, error) {
+	claims := merge(grant.Claims, map[string]interface{}{
+		"iss":       issuerURL(r, &h.cfg.JWK),
+		"aud":       client.ID,
+		"auth_time": grant.AuthTime.Unix(),
+	})
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+
+	signed, err := h.tokenService.SignToken(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign ID token: %w", err)
+	}
+
+	return string(signed), nil
+}
@@ -0,0 +1,318 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/murar8/local-jwks-server/internal/authcode"
+	"github.com/murar8/local-jwks-server/internal/refresh"
+	"github.com/murar8/local-jwks-server/internal/revocation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleTokenClientCredentials(t *testing.T) {
+	t.Parallel()
+
+	t.Run("issues an access token to a client authenticated with basic auth", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeTokenService()
+		req := newFormRequest(http.MethodPost, "http://localhost:8080/oauth/token", url.Values{"grant_type": {"client_credentials"}, "scope": {"read"}})
+		req.SetBasicAuth("service", url.QueryEscape("s3cr3t:/"))
+		res := serveOAuthRequest(ts, revocation.New(), req)
+
+		var data map[string]interface{}
+		decodeBody(t, res, &data)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "no-store", res.Header.Get("Cache-Control"))
+		assert.Equal(t, "Bearer", data["token_type"])
+		assert.EqualValues(t, 3600, data["expires_in"])
+		assert.Equal(t, "read", data["scope"])
+
+		signed := []byte(data["access_token"].(string))
+		msg, err := jws.Parse(signed)
+		require.NoError(t, err)
+		assert.Equal(t, "at+jwt", msg.Signatures()[0].ProtectedHeaders().Type())
+
+		set, _ := ts.GetKeySet()
+		parsed, err := jwt.Parse(signed, jwt.WithKeySet(set))
+		require.NoError(t, err)
+		assert.Equal(t, "http://localhost:8080", parsed.Issuer())
+		assert.Equal(t, "service", parsed.Subject())
+		assert.Equal(t, []string{"api"}, parsed.Audience())
+		assert.Equal(t, "service", parsed.PrivateClaims()["client_id"])
+		assert.Equal(t, "read", parsed.PrivateClaims()["scope"])
+	})
+
+	t.Run("signs the access token with the tenant issuer", func(t *testing.T) {
+		t.Parallel()
+
+		form := url.Values{"grant_type": {"client_credentials"}, "client_id": {"service"}, "client_secret": {"s3cr3t:/"}}
+		req := newFormRequest(http.MethodPost, "http://localhost:8080/acme/oauth/token", form)
+		res := serveOAuthRequest(makeTokenService(), revocation.New(), req)
+
+		var data map[string]interface{}
+		decodeBody(t, res, &data)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		parsed, err := jwt.Parse([]byte(data["access_token"].(string)), jwt.WithVerify(false))
+		require.NoError(t, err)
+		assert.Equal(t, "http://localhost:8080/acme", parsed.Issuer())
+	})
+
+	t.Run("authenticates the client with the form parameters", func(t *testing.T) {
+		t.Parallel()
+
+		form := url.Values{"grant_type": {"client_credentials"}, "client_id": {"service"}, "client_secret": {"s3cr3t:/"}}
+		res := makeOAuthRequest(makeTokenService(), http.MethodPost, "/oauth/token", form)
+
+		var data map[string]interface{}
+		decodeBody(t, res, &data)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "read write", data["scope"])
+	})
+
+	t.Run("returns an invalid client error if authentication fails", func(t *testing.T) {
+		t.Parallel()
+
+		req := newFormRequest(http.MethodPost, "/oauth/token", url.Values{"grant_type": {"client_credentials"}})
+		req.SetBasicAuth("service", "wrong")
+		res := serveOAuthRequest(makeTokenService(), revocation.New(), req)
+
+		var data map[string]interface{}
+		decodeBody(t, res, &data)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		assert.Equal(t, "invalid_client", data["error"])
+		assert.NotEmpty(t, res.Header.Get("WWW-Authenticate"))
+
+		form := url.Values{"grant_type": {"client_credentials"}, "client_id": {"unknown"}}
+		res = makeOAuthRequest(makeTokenService(), http.MethodPost, "/oauth/token", form)
+		decodeBody(t, res, &data)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		assert.Equal(t, "invalid_client", data["error"])
+	})
+
+	t.Run("returns an error for the invalid requests", func(t *testing.T) {
+		t.Parallel()
+
+		cases := []struct {
+			form url.Values
+			code string
+		}{
+			{url.Values{}, "invalid_request"},
+			{url.Values{"grant_type": {"device_code"}}, "unsupported_grant_type"},
+			{url.Values{"grant_type": {"client_credentials"}, "client_id": {"public"}}, "unauthorized_client"},
+			{
+				url.Values{"grant_type": {"client_credentials"}, "client_id": {"service"}, "client_secret": {"s3cr3t:/"}, "scope": {"admin"}},
+				"invalid_scope",
+			},
+		}
+
+		for _, c := range cases {
+			res := makeOAuthRequest(makeTokenService(), http.MethodPost, "/oauth/token", c.form)
+
+			var data map[string]interface{}
+			decodeBody(t, res, &data)
+			assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+			assert.Equal(t, c.code, data["error"])
+		}
+	})
+}
+
+// requestRefreshToken redeems an authorization code of the public client and
+// returns the refresh token.
+func requestRefreshToken(t *testing.T, router http.Handler) string {
+	t.Helper()
+
+	location := authorize(t, router, publicAuthorizeForm())
+	res := serveRequest(router, newFormRequest(http.MethodPost, "/oauth/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {"public"},
+		"code":          {location.Query().Get("code")},
+		"redirect_uri":  {"http://localhost:3000/callback?app=spa"},
+		"code_verifier": {testCodeVerifier},
+	}))
+
+	var data map[string]interface{}
+	decodeBody(t, res, &data)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.NotEmpty(t, data["refresh_token"])
+
+	return data["refresh_token"].(string)
+}
+
+func refreshTokenRequest(router http.Handler, refreshToken string) (*http.Response, map[string]interface{}) {
+	form := url.Values{"grant_type": {"refresh_token"}, "client_id": {"public"}, "refresh_token": {refreshToken}}
+	res := serveRequest(router, newFormRequest(http.MethodPost, "/oauth/token", form))
+
+	var data map[string]interface{}
+	_ = json.NewDecoder(res.Body).Decode(&data)
+
+	return res, data
+}
+
+func TestHandleTokenRefreshToken(t *testing.T) {
+	t.Parallel()
+
+	t.Run("rotates the refresh token", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeTokenService()
+		router := newOAuthRouter(ts, revocation.New(), authcode.New(time.Minute), refresh.New(time.Hour), true)
+		refreshToken := requestRefreshToken(t, router)
+
+		res, data := refreshTokenRequest(router, refreshToken)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.NotEqual(t, refreshToken, data["refresh_token"])
+		assert.Equal(t, "openid", data["scope"])
+
+		idToken, err := jwt.Parse([]byte(data["id_token"].(string)), jwt.WithVerify(false))
+		require.NoError(t, err)
+		assert.Equal(t, "alice", idToken.Subject())
+		assert.NotContains(t, idToken.PrivateClaims(), "nonce")
+
+		res, _ = refreshTokenRequest(router, data["refresh_token"].(string))
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	})
+
+	t.Run("revokes the token family on reuse", func(t *testing.T) {
+		t.Parallel()
+
+		router := newOAuthRouter(makeTokenService(), revocation.New(), authcode.New(time.Minute), refresh.New(time.Hour), true)
+		refreshToken := requestRefreshToken(t, router)
+
+		_, data := refreshTokenRequest(router, refreshToken)
+		rotated := data["refresh_token"].(string)
+
+		res, data := refreshTokenRequest(router, refreshToken)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+		assert.Equal(t, "invalid_grant", data["error"])
+		assert.Equal(t, "refresh token reuse detected", data["error_description"])
+
+		res, data = refreshTokenRequest(router, rotated)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+		assert.Equal(t, "invalid_grant", data["error"])
+	})
+
+	t.Run("keeps the refresh token without rotation", func(t *testing.T) {
+		t.Parallel()
+
+		router := newOAuthRouter(makeTokenService(), revocation.New(), authcode.New(time.Minute), refresh.New(time.Hour), false)
+		refreshToken := requestRefreshToken(t, router)
+
+		for range 2 {
+			res, data := refreshTokenRequest(router, refreshToken)
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			assert.Equal(t, refreshToken, data["refresh_token"])
+		}
+	})
+
+	t.Run("rejects revoked refresh tokens", func(t *testing.T) {
+		t.Parallel()
+
+		router := newOAuthRouter(makeTokenService(), revocation.New(), authcode.New(time.Minute), refresh.New(time.Hour), true)
+		refreshToken := requestRefreshToken(t, router)
+
+		res := serveRequest(router, newFormRequest(http.MethodPost, "/oauth/revoke", url.Values{"token": {refreshToken}}))
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		res, data := refreshTokenRequest(router, refreshToken)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+		assert.Equal(t, "invalid_grant", data["error"])
+	})
+
+	t.Run("rejects a scope exceeding the original grant", func(t *testing.T) {
+		t.Parallel()
+
+		router := newOAuthRouter(makeTokenService(), revocation.New(), authcode.New(time.Minute), refresh.New(time.Hour), true)
+		refreshToken := requestRefreshToken(t, router)
+
+		form := url.Values{"grant_type": {"refresh_token"}, "client_id": {"public"}, "refresh_token": {refreshToken}, "scope": {"read"}}
+		res := serveRequest(router, newFormRequest(http.MethodPost, "/oauth/token", form))
+
+		var data map[string]interface{}
+		decodeBody(t, res, &data)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+		assert.Equal(t, "invalid_scope", data["error"])
+
+		// The failed request does not consume the refresh token.
+		res, data = refreshTokenRequest(router, refreshToken)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.NotEqual(t, refreshToken, data["refresh_token"])
+	})
+}
+
+func TestHandleTokenPassword(t *testing.T) {
+	t.Parallel()
+
+	t.Run("issues tokens with the user claims", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeTokenService()
+		form := url.Values{
+			"grant_type": {"password"},
+			"client_id":  {"public"},
+			"username":   {"alice"},
+			"password":   {"wonderland"},
+			"scope":      {"openid"},
+		}
+		res := serveOAuthRequest(ts, revocation.New(), newFormRequest(http.MethodPost, "/oauth/token", form))
+
+		var data map[string]interface{}
+		decodeBody(t, res, &data)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "openid", data["scope"])
+		assert.NotEmpty(t, data["refresh_token"])
+
+		set, _ := ts.GetKeySet()
+		for _, name := range []string{"access_token", "id_token"} {
+			parsed, err := jwt.Parse([]byte(data[name].(string)), jwt.WithKeySet(set))
+			require.NoError(t, err, name)
+			assert.Equal(t, "alice", parsed.Subject(), name)
+			assert.Equal(t, "Alice", parsed.PrivateClaims()["name"], name)
+		}
+	})
+
+	t.Run("rejects invalid credentials", func(t *testing.T) {
+		t.Parallel()
+
+		for _, credentials := range [][2]string{{"alice", "wrong"}, {"missing", "wonderland"}, {"", ""}} {
+			form := url.Values{
+				"grant_type": {"password"},
+				"client_id":  {"public"},
+				"username":   {credentials[0]},
+				"password":   {credentials[1]},
+			}
+			res := makeOAuthRequest(makeTokenService(), http.MethodPost, "/oauth/token", form)
+
+			var data map[string]interface{}
+			decodeBody(t, res, &data)
+			assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+			assert.Equal(t, "invalid_grant", data["error"])
+		}
+	})
+
+	t.Run("rejects a scope that is not allowed for the client", func(t *testing.T) {
+		t.Parallel()
+
+		form := url.Values{
+			"grant_type": {"password"},
+			"client_id":  {"public"},
+			"username":   {"alice"},
+			"password":   {"wonderland"},
+			"scope":      {"read"},
+		}
+		res := makeOAuthRequest(makeTokenService(), http.MethodPost, "/oauth/token", form)
+
+		var data map[string]interface{}
+		decodeBody(t, res, &data)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+		assert.Equal(t, "invalid_scope", data["error"])
+	})
+}
@@ -2,8 +2,12 @@ package handler
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/go-chi/render"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/murar8/local-jwks-server/internal/rotation"
+	"github.com/murar8/local-jwks-server/internal/token"
 )
 
 type HandleSignResponse struct {
@@ -24,3 +28,75 @@ func (e *ErrorResponse) Render(_ http.ResponseWriter, r *http.Request) error {
 	render.Status(r, e.StatusCode)
 	return nil
 }
+
+// OAuthErrorResponse is an RFC 6749 error response.
+type OAuthErrorResponse struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	StatusCode  int    `json:"-"`
+}
+
+func (e *OAuthErrorResponse) Render(_ http.ResponseWriter, r *http.Request) error {
+	render.Status(r, e.StatusCode)
+	return nil
+}
+
+// TokenResponse is an RFC 6749 access token response.
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+func (t *TokenResponse) Render(w http.ResponseWriter, _ *http.Request) error {
+	// Token responses must not be cached, see RFC 6749 section 5.1.
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	return nil
+}
+
+// AdminKeyResponse describes a key held by the token service.
+type AdminKeyResponse struct {
+	KeyID     string     `json:"kid"`
+	Alg       string     `json:"alg"`
+	Status    string     `json:"status"`
+	RetiresAt *time.Time `json:"retires_at,omitempty"`
+	PublicKey jwk.Key    `json:"jwk,omitempty"`
+}
+
+func newAdminKeyResponse(key jwk.Key, status *rotation.Status) *AdminKeyResponse {
+	res := &AdminKeyResponse{
+		KeyID:  key.KeyID(),
+		Alg:    key.Algorithm().String(),
+		Status: "active",
+	}
+
+	if key.KeyID() == status.Current {
+		res.Status = "current"
+	}
+
+	for _, prev := range status.Previous {
+		if prev.KeyID == key.KeyID() {
+			res.Status = "previous"
+			res.RetiresAt = &prev.RetiresAt
+		}
+	}
+
+	// The public part is always available for the supported key types, while
+	// shared secrets are only exposed through the secret endpoint.
+	if !token.IsSymmetric(key) {
+		res.PublicKey, _ = key.PublicKey()
+	}
+
+	return res
+}
+
+func (a *AdminKeyResponse) Render(_ http.ResponseWriter, r *http.Request) error {
+	if r.Method == http.MethodPost {
+		render.Status(r, http.StatusCreated)
+	}
+	return nil
+}
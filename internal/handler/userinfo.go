@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/render"
+	"github.com/murar8/local-jwks-server/internal/token"
+)
+
+// HandleUserInfo implements the OpenID Connect UserInfo endpoint. The access
+// token is read from the Authorization header or, for POST requests, from the
+// access_token form parameter as described in RFC 6750. The response is a
+// signed JWT if the client accepts application/jwt.
+func (h *oauthHandler) HandleUserInfo(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		oauthError(w, r, errInvalidRequest, err.Error())
+		return
+	}
+
+	accessToken := bearerToken(r)
+	if accessToken == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="userinfo"`)
+		oauthError(w, r, errInvalidToken, "missing access token")
+		return
+	}
+
+	v := h.tokenService.VerifyToken(
+		[]byte(accessToken),
+		token.WithSkew(h.cfg.JWK.VerifySkew),
+		token.WithRevocationList(h.revocations),
+	)
+	if !v.Valid || !isAccessToken(v) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="userinfo", error="invalid_token"`)
+		oauthError(w, r, errInvalidToken, "the access token is invalid")
+		return
+	}
+
+	claims := h.userInfoClaims(v.Claims)
+
+	if !strings.Contains(r.Header.Get("Accept"), "application/jwt") {
+		render.JSON(w, r, claims)
+		return
+	}
+
+	signed, err := h.signUserInfo(r, claims, v.Claims["client_id"])
+	if err != nil {
+		oauthError(w, r, errServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/jwt")
+	_, _ = w.Write(signed)
+}
+
+// isAccessToken reports whether the token is an access token rather than an
+// ID token, which is signed by the same keys. Access tokens are typed at+jwt
+// as described in RFC 9068, or carry the client_id claim.
+func isAccessToken(v *token.Verification) bool {
+	typ, _ := v.Header["typ"].(string)
+	if strings.EqualFold(typ, "at+jwt") || strings.EqualFold(typ, "application/at+jwt") {
+		return true
+	}
+
+	clientID, _ := v.Claims["client_id"].(string)
+	return clientID != ""
+}
+
+// userInfoClaims returns the claims of the user from the users file, or the
+// claims of the access token describing the user if the subject is unknown.
+func (h *oauthHandler) userInfoClaims(tokenClaims map[string]interface{}) map[string]interface{} {
+	sub, _ := tokenClaims["sub"].(string)
+	if user, exists := h.cfg.OAuth.FindUser(sub); exists {
+		return merge(user.Claims, map[string]interface{}{"sub": user.Subject})
+	}
+
+	// Only the claims describing the user are returned.
+	claims := merge(tokenClaims, nil)
+	for _, name := range []string{
+		"iss", "aud", "exp", "nbf", "iat", "jti", "client_id", "scope", "azp", "auth_time", "nonce",
+	} {
+		delete(claims, name)
+	}
+
+	return claims
+}
+
+// signUserInfo signs the claims for the client the access token was issued
+// to, see OpenID Connect Core section 5.3.2.
+func (h *oauthHandler) signUserInfo(
+	r *http.Request,
+	claims map[string]interface{},
+	clientID interface{},
+) ([]byte, error) {
+	claims = merge(claims, map[string]interface{}{"iss": issuerURL(r, &h.cfg.JWK)})
+	if clientID != nil {
+		claims["aud"] = clientID
+	}
+
+	signed, err := h.tokenService.SignToken(claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign user info: %w", err)
+	}
+
+	return signed, nil
+}
+
+// bearerToken returns the access token of the request, see RFC 6750
+// sections 2.1 and 2.2.
+func bearerToken(r *http.Request) string {
+	scheme, credentials, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if found && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(credentials)
+	}
+
+	return r.PostForm.Get("access_token")
+}
@@ -0,0 +1,168 @@
+package handler_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/murar8/local-jwks-server/internal/revocation"
+	"github.com/murar8/local-jwks-server/internal/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleUserInfo(t *testing.T) {
+	t.Parallel()
+
+	t.Run("returns the claims of a known user", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeTokenService()
+		signed, err := ts.SignToken(map[string]interface{}{"sub": "alice", "client_id": "public"})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+		req.Header.Set("Authorization", "Bearer "+string(signed))
+		res := serveOAuthRequest(ts, revocation.New(), req)
+
+		var data map[string]interface{}
+		decodeBody(t, res, &data)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, map[string]interface{}{"sub": "alice", "name": "Alice"}, data)
+	})
+
+	t.Run("returns the user claims of the token for unknown users", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeTokenService()
+		payload := map[string]interface{}{
+			"sub":       "carol",
+			"email":     "carol@example.com",
+			"client_id": "public",
+			"scope":     "openid",
+			"exp":       time.Now().Add(time.Hour).Unix(),
+		}
+		signed, err := ts.SignToken(payload)
+		require.NoError(t, err)
+
+		form := url.Values{"access_token": {string(signed)}}
+		res := makeOAuthRequest(ts, http.MethodPost, "/userinfo", form)
+
+		var data map[string]interface{}
+		decodeBody(t, res, &data)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, map[string]interface{}{"sub": "carol", "email": "carol@example.com"}, data)
+	})
+
+	t.Run("returns a signed response if requested", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeTokenService()
+		signed, err := ts.SignToken(map[string]interface{}{"sub": "alice", "client_id": "public"})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/userinfo", nil)
+		req.Header.Set("Authorization", "Bearer "+string(signed))
+		req.Header.Set("Accept", "application/jwt")
+		res := serveOAuthRequest(ts, revocation.New(), req)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "application/jwt", res.Header.Get("Content-Type"))
+
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+
+		set, _ := ts.GetKeySet()
+		parsed, err := jwt.Parse(body, jwt.WithKeySet(set))
+		require.NoError(t, err)
+		assert.Equal(t, "alice", parsed.Subject())
+		assert.Equal(t, "http://localhost:8080", parsed.Issuer())
+		assert.Equal(t, []string{"public"}, parsed.Audience())
+		assert.Equal(t, "Alice", parsed.PrivateClaims()["name"])
+	})
+
+	t.Run("rejects requests without a valid access token", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeTokenService()
+		expired, err := ts.SignToken(map[string]interface{}{"sub": "alice", "exp": time.Now().Add(-time.Hour).Unix()})
+		require.NoError(t, err)
+
+		for _, authorization := range []string{"", "Bearer invalid", "Bearer " + string(expired), "Basic YWxpY2U6c2VjcmV0"} {
+			req := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+			if authorization != "" {
+				req.Header.Set("Authorization", authorization)
+			}
+			res := serveOAuthRequest(ts, revocation.New(), req)
+
+			var data map[string]interface{}
+			decodeBody(t, res, &data)
+			assert.Equal(t, http.StatusUnauthorized, res.StatusCode, authorization)
+			assert.Equal(t, "invalid_token", data["error"], authorization)
+			assert.Contains(t, res.Header.Get("WWW-Authenticate"), "Bearer", authorization)
+		}
+	})
+
+	t.Run("rejects ID tokens", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeTokenService()
+		form := url.Values{
+			"grant_type": {"password"},
+			"client_id":  {"public"},
+			"username":   {"alice"},
+			"password":   {"wonderland"},
+			"scope":      {"openid"},
+		}
+		res := makeOAuthRequest(ts, http.MethodPost, "/oauth/token", form)
+
+		var tokens map[string]interface{}
+		decodeBody(t, res, &tokens)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		req := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+		req.Header.Set("Authorization", "Bearer "+tokens["id_token"].(string))
+		res = serveOAuthRequest(ts, revocation.New(), req)
+
+		var data map[string]interface{}
+		decodeBody(t, res, &data)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		assert.Equal(t, "invalid_token", data["error"])
+		assert.Contains(t, res.Header.Get("WWW-Authenticate"), `error="invalid_token"`)
+	})
+
+	t.Run("accepts access tokens typed at+jwt without a client_id", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeTokenService()
+		header := map[string]interface{}{"typ": "at+jwt"}
+		signed, err := ts.SignToken(map[string]interface{}{"sub": "alice"}, token.WithHeaders(header))
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+		req.Header.Set("Authorization", "Bearer "+string(signed))
+		res := serveOAuthRequest(ts, revocation.New(), req)
+		res.Body.Close()
+
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	})
+
+	t.Run("rejects revoked access tokens", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeTokenService()
+		signed, err := ts.SignToken(map[string]interface{}{"sub": "alice", "jti": "revoked-token"})
+		require.NoError(t, err)
+
+		revocations := revocation.New()
+		revocations.Revoke("revoked-token", time.Time{})
+
+		req := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+		req.Header.Set("Authorization", "Bearer "+string(signed))
+		res := serveOAuthRequest(ts, revocations, req)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+}
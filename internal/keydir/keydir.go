@@ -0,0 +1,282 @@
+package keydir
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/murar8/local-jwks-server/internal/config"
+	"github.com/murar8/local-jwks-server/internal/token"
+)
+
+type file struct {
+	hash [sha256.Size]byte
+	keys []jwk.Key
+}
+
+// Watcher loads keys from every file in a directory and keeps a token
+// service in sync with the directory contents.
+type Watcher struct {
+	mu       sync.Mutex
+	dir      string
+	interval time.Duration
+	keyCfg   config.Key
+	files    map[string]file
+}
+
+func New(cfg *config.JWK) *Watcher {
+	return &Watcher{
+		dir:      cfg.KeysDir,
+		interval: cfg.KeysDirInterval,
+		keyCfg: config.Key{
+			Alg:            cfg.Alg,
+			KeyOps:         cfg.KeyOps,
+			Passphrase:     cfg.KeyPassphrase,
+			SelfSignedCert: cfg.SelfSignedCert,
+		},
+		files: map[string]file{},
+	}
+}
+
+// Load reads the keys from every file in the directory, sorted by file name.
+// Unlike Sync, any invalid file results in an error.
+func (w *Watcher) Load() ([]jwk.Key, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	names, err := w.list()
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []jwk.Key
+
+	for _, name := range names {
+		f, readErr := w.read(name)
+		if readErr != nil {
+			return nil, readErr
+		}
+
+		w.files[name] = f
+		keys = append(keys, f.keys...)
+	}
+
+	return keys, nil
+}
+
+// Run synchronizes the token service with the directory every configured
+// interval until the context is canceled. It returns immediately if no
+// interval is configured.
+func (w *Watcher) Run(ctx context.Context, tokenService token.Service) error {
+	if w.interval <= 0 {
+		return nil
+	}
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := w.Sync(tokenService); err != nil {
+				log.Printf("failed to read keys directory %s: %s", w.dir, err)
+			}
+		}
+	}
+}
+
+// Sync publishes the keys of new and modified files and removes the keys of
+// deleted files. Files that cannot be parsed are skipped, leaving their
+// previous keys in place.
+func (w *Watcher) Sync(tokenService token.Service) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	names, err := w.list()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		f, readErr := w.read(name)
+		if readErr != nil {
+			log.Printf("failed to load key file %s: %s", name, readErr)
+			continue
+		}
+
+		prev, exists := w.files[name]
+		if exists && prev.hash == f.hash {
+			continue
+		}
+
+		log.Printf("key file %s changed", name)
+		published := applyKeys(tokenService, prev.keys, f.keys)
+
+		// Only the keys published from the file are recorded, so that keys
+		// owned by other files are never removed on its behalf. Clearing the
+		// hash retries the other keys on the next sync.
+		if len(published) != len(f.keys) {
+			f.hash = [sha256.Size]byte{}
+		}
+		f.keys = published
+		w.files[name] = f
+	}
+
+	// Deleted files are handled last so that the default key can be moved to
+	// a key added in the meantime.
+	for name, prev := range w.files {
+		if slices.Contains(names, name) {
+			continue
+		}
+
+		log.Printf("key file %s removed", name)
+		applyKeys(tokenService, prev.keys, nil)
+		delete(w.files, name)
+	}
+
+	return nil
+}
+
+// applyKeys replaces the keys previously loaded from a file with the new
+// ones and returns the keys of the file that are published. New keys are
+// published before stale ones are removed so that the default key can be
+// moved to one of them.
+func applyKeys(tokenService token.Service, prev, next []jwk.Key) []jwk.Key {
+	var published []jwk.Key
+
+	for _, key := range next {
+		var err error
+		if containsKeyID(prev, key.KeyID()) {
+			err = tokenService.ReplaceKey(key)
+		} else {
+			err = tokenService.AddKey(key)
+		}
+		if err == nil {
+			published = append(published, key)
+		} else {
+			log.Printf("failed to publish key %s: %s", key.KeyID(), err)
+		}
+	}
+
+	for _, key := range prev {
+		if containsKeyID(next, key.KeyID()) {
+			// The previous version stays published if it could not be replaced.
+			if !containsKeyID(published, key.KeyID()) {
+				published = append(published, key)
+			}
+			continue
+		}
+
+		removeKey(tokenService, key.KeyID(), next)
+	}
+
+	return published
+}
+
+// removeKey removes a key from the token service. If it is the default key,
+// another key is promoted first, preferring one loaded from the same file.
+func removeKey(tokenService token.Service, kid string, candidates []jwk.Key) {
+	err := tokenService.RemoveKey(kid)
+	if !errors.Is(err, token.ErrDefaultKey) {
+		if err != nil {
+			log.Printf("failed to remove key %s: %s", kid, err)
+		}
+		return
+	}
+
+	for _, key := range slices.Concat(candidates, tokenService.GetKeys()) {
+		if key.KeyID() == kid {
+			continue
+		}
+
+		if err = tokenService.SetDefaultKey(key.KeyID()); err == nil {
+			log.Printf("default key changed to %s", key.KeyID())
+			_ = tokenService.RemoveKey(kid)
+			return
+		}
+	}
+
+	log.Printf("keeping default key %s since no other key is available", kid)
+}
+
+// list returns the names of the regular files in the directory. Hidden files
+// are ignored, which also skips the metadata of mounted volumes.
+func (w *Watcher) list() ([]string, error) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keys directory: %w", err)
+	}
+
+	var names []string
+
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		// Stat follows symbolic links, which are used by mounted secrets.
+		info, statErr := os.Stat(filepath.Join(w.dir, entry.Name()))
+		if statErr != nil || !info.Mode().IsRegular() {
+			continue
+		}
+
+		names = append(names, entry.Name())
+	}
+
+	return names, nil
+}
+
+func (w *Watcher) read(name string) (file, error) {
+	data, err := os.ReadFile(filepath.Join(w.dir, name))
+	if err != nil {
+		return file{}, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	f := file{hash: sha256.Sum256(data)}
+
+	// Files with the same content are unchanged, so there is no need to
+	// parse them again.
+	if prev, exists := w.files[name]; exists && prev.hash == f.hash {
+		return prev, nil
+	}
+
+	// Files can hold keys of different types, so keys without an algorithm
+	// fall back to the default algorithm of their type.
+	raws, err := token.ParsePrivateKeys(
+		data,
+		w.keyCfg.Alg,
+		token.WithPassphrase([]byte(w.keyCfg.Passphrase)),
+		token.WithInferredAlgorithm(),
+	)
+	if err != nil {
+		return file{}, fmt.Errorf("%s: %w", name, err)
+	}
+
+	for _, raw := range raws {
+		key, keyErr := token.NewKey(raw, &w.keyCfg)
+		if keyErr == nil && w.keyCfg.SelfSignedCert {
+			keyErr = token.EnsureCertificate(key)
+		}
+		if keyErr != nil {
+			return file{}, fmt.Errorf("%s: %w", name, keyErr)
+		}
+		f.keys = append(f.keys, key)
+	}
+
+	return f, nil
+}
+
+func containsKeyID(keys []jwk.Key, kid string) bool {
+	return slices.ContainsFunc(keys, func(key jwk.Key) bool { return key.KeyID() == kid })
+}
@@ -0,0 +1,337 @@
+package keydir_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/murar8/local-jwks-server/internal/config"
+	"github.com/murar8/local-jwks-server/internal/keydir"
+	"github.com/murar8/local-jwks-server/internal/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeKey writes a new key to the directory and returns its key ID.
+func writeKey(t *testing.T, dir, name string, alg jwa.SignatureAlgorithm) string {
+	t.Helper()
+
+	raw, err := token.GeneratePrivateKey(alg, 2048)
+	require.NoError(t, err)
+
+	data, err := token.MarshalPrivateKey(raw)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o600))
+
+	key, err := token.NewKey(raw, &config.Key{Alg: alg})
+	require.NoError(t, err)
+
+	return key.KeyID()
+}
+
+func keyIDs(keys []jwk.Key) []string {
+	kids := make([]string, 0, len(keys))
+	for _, key := range keys {
+		kids = append(kids, key.KeyID())
+	}
+	return kids
+}
+
+func makeWatcher(t *testing.T, dir string) (*keydir.Watcher, token.Service) {
+	t.Helper()
+
+	cfg := &config.JWK{Alg: jwa.ES256, KeysDir: dir}
+	watcher := keydir.New(cfg)
+
+	keys, err := watcher.Load()
+	require.NoError(t, err)
+
+	ts, err := token.New(keys, cfg)
+	require.NoError(t, err)
+
+	return watcher, ts
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	t.Run("loads every key file sorted by name", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		b := writeKey(t, dir, "b.pem", jwa.ES256)
+		a := writeKey(t, dir, "a.pem", jwa.ES256)
+
+		keys, err := keydir.New(&config.JWK{Alg: jwa.ES256, KeysDir: dir}).Load()
+		require.NoError(t, err)
+		assert.Equal(t, []string{a, b}, keyIDs(keys))
+	})
+
+	t.Run("infers the algorithm of keys that do not match the configured one", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		writeKey(t, dir, "a.pem", jwa.ES256)
+		writeKey(t, dir, "b.pem", jwa.RS256)
+		writeKey(t, dir, "c.pem", jwa.EdDSA)
+
+		keys, err := keydir.New(&config.JWK{Alg: jwa.ES256, KeysDir: dir}).Load()
+		require.NoError(t, err)
+		require.Len(t, keys, 3)
+		assert.Equal(t, jwa.ES256, keys[0].Algorithm())
+		assert.Equal(t, jwa.RS256, keys[1].Algorithm())
+		assert.Equal(t, jwa.EdDSA, keys[2].Algorithm())
+	})
+
+	t.Run("ignores hidden files and directories", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		kid := writeKey(t, dir, "key.pem", jwa.ES256)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, ".hidden"), []byte("invalid"), 0o600))
+		require.NoError(t, os.Mkdir(filepath.Join(dir, "nested"), 0o700))
+
+		keys, err := keydir.New(&config.JWK{Alg: jwa.ES256, KeysDir: dir}).Load()
+		require.NoError(t, err)
+		assert.Equal(t, []string{kid}, keyIDs(keys))
+	})
+
+	t.Run("returns an error for invalid key files", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "key.pem"), []byte("invalid"), 0o600))
+
+		keys, err := keydir.New(&config.JWK{Alg: jwa.ES256, KeysDir: dir}).Load()
+		assert.Nil(t, keys)
+		require.ErrorIs(t, err, token.ErrInvalidPEM)
+		assert.EqualError(t, err, "key.pem: invalid PEM")
+	})
+
+	t.Run("returns an error if the directory does not exist", func(t *testing.T) {
+		t.Parallel()
+
+		dir := filepath.Join(t.TempDir(), "missing")
+
+		keys, err := keydir.New(&config.JWK{Alg: jwa.ES256, KeysDir: dir}).Load()
+		assert.Nil(t, keys)
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
+
+func TestSync(t *testing.T) {
+	t.Parallel()
+
+	t.Run("publishes keys from new files", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		a := writeKey(t, dir, "a.pem", jwa.ES256)
+		watcher, ts := makeWatcher(t, dir)
+
+		b := writeKey(t, dir, "b.pem", jwa.ES256)
+		require.NoError(t, watcher.Sync(ts))
+
+		assert.Equal(t, []string{a, b}, keyIDs(ts.GetKeys()))
+		assert.Equal(t, a, ts.GetKey().KeyID())
+	})
+
+	t.Run("removes keys of deleted files", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		a := writeKey(t, dir, "a.pem", jwa.ES256)
+		writeKey(t, dir, "b.pem", jwa.ES256)
+		watcher, ts := makeWatcher(t, dir)
+
+		require.NoError(t, os.Remove(filepath.Join(dir, "b.pem")))
+		require.NoError(t, watcher.Sync(ts))
+
+		assert.Equal(t, []string{a}, keyIDs(ts.GetKeys()))
+	})
+
+	t.Run("keeps the key of another file sharing its key ID", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		a := writeKey(t, dir, "a.pem", jwa.ES256)
+		b := writeKey(t, dir, "b.pem", jwa.ES256)
+		watcher, ts := makeWatcher(t, dir)
+
+		data, err := os.ReadFile(filepath.Join(dir, "b.pem"))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "c.pem"), data, 0o600))
+		require.NoError(t, watcher.Sync(ts))
+
+		require.NoError(t, os.Remove(filepath.Join(dir, "c.pem")))
+		require.NoError(t, watcher.Sync(ts))
+
+		assert.Equal(t, []string{a, b}, keyIDs(ts.GetKeys()))
+	})
+
+	t.Run("publishes a duplicate key once the other file is deleted", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		a := writeKey(t, dir, "a.pem", jwa.ES256)
+		b := writeKey(t, dir, "b.pem", jwa.ES256)
+		watcher, ts := makeWatcher(t, dir)
+
+		data, err := os.ReadFile(filepath.Join(dir, "b.pem"))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "c.pem"), data, 0o600))
+		require.NoError(t, watcher.Sync(ts))
+
+		// Deleted files are handled last, so the key is published on the
+		// following sync.
+		require.NoError(t, os.Remove(filepath.Join(dir, "b.pem")))
+		require.NoError(t, watcher.Sync(ts))
+		require.NoError(t, watcher.Sync(ts))
+		assert.Equal(t, []string{a, b}, keyIDs(ts.GetKeys()))
+
+		require.NoError(t, os.Remove(filepath.Join(dir, "c.pem")))
+		require.NoError(t, watcher.Sync(ts))
+		assert.Equal(t, []string{a}, keyIDs(ts.GetKeys()))
+	})
+
+	t.Run("replaces keys of modified files", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		a := writeKey(t, dir, "a.pem", jwa.ES256)
+		writeKey(t, dir, "b.pem", jwa.ES256)
+		watcher, ts := makeWatcher(t, dir)
+
+		b := writeKey(t, dir, "b.pem", jwa.ES256)
+		require.NoError(t, watcher.Sync(ts))
+
+		assert.Equal(t, []string{a, b}, keyIDs(ts.GetKeys()))
+	})
+
+	t.Run("moves the default key when its file is modified", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		writeKey(t, dir, "a.pem", jwa.ES256)
+		watcher, ts := makeWatcher(t, dir)
+
+		a := writeKey(t, dir, "a.pem", jwa.ES256)
+		require.NoError(t, watcher.Sync(ts))
+
+		assert.Equal(t, []string{a}, keyIDs(ts.GetKeys()))
+		assert.Equal(t, a, ts.GetKey().KeyID())
+	})
+
+	t.Run("moves the default key when its file is deleted", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		writeKey(t, dir, "a.pem", jwa.ES256)
+		b := writeKey(t, dir, "b.pem", jwa.ES256)
+		watcher, ts := makeWatcher(t, dir)
+
+		require.NoError(t, os.Remove(filepath.Join(dir, "a.pem")))
+		require.NoError(t, watcher.Sync(ts))
+
+		assert.Equal(t, []string{b}, keyIDs(ts.GetKeys()))
+		assert.Equal(t, b, ts.GetKey().KeyID())
+	})
+
+	t.Run("moves the default key to a key added at the same time", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		writeKey(t, dir, "a.pem", jwa.ES256)
+		watcher, ts := makeWatcher(t, dir)
+
+		require.NoError(t, os.Remove(filepath.Join(dir, "a.pem")))
+		b := writeKey(t, dir, "b.pem", jwa.ES256)
+		require.NoError(t, watcher.Sync(ts))
+
+		assert.Equal(t, []string{b}, keyIDs(ts.GetKeys()))
+		assert.Equal(t, b, ts.GetKey().KeyID())
+	})
+
+	t.Run("keeps the default key if no other key is available", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		a := writeKey(t, dir, "a.pem", jwa.ES256)
+		watcher, ts := makeWatcher(t, dir)
+
+		require.NoError(t, os.Remove(filepath.Join(dir, "a.pem")))
+		require.NoError(t, watcher.Sync(ts))
+
+		assert.Equal(t, []string{a}, keyIDs(ts.GetKeys()))
+	})
+
+	t.Run("keeps the previous keys of invalid files", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		a := writeKey(t, dir, "a.pem", jwa.ES256)
+		b := writeKey(t, dir, "b.pem", jwa.ES256)
+		watcher, ts := makeWatcher(t, dir)
+
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "b.pem"), []byte("invalid"), 0o600))
+		require.NoError(t, watcher.Sync(ts))
+
+		assert.Equal(t, []string{a, b}, keyIDs(ts.GetKeys()))
+	})
+
+	t.Run("returns an error if the directory is removed", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		writeKey(t, dir, "a.pem", jwa.ES256)
+		watcher, ts := makeWatcher(t, dir)
+
+		require.NoError(t, os.RemoveAll(dir))
+		require.ErrorIs(t, watcher.Sync(ts), os.ErrNotExist)
+	})
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	t.Run("synchronizes the directory periodically", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		writeKey(t, dir, "a.pem", jwa.ES256)
+
+		cfg := &config.JWK{Alg: jwa.ES256, KeysDir: dir, KeysDirInterval: 10 * time.Millisecond}
+		watcher := keydir.New(cfg)
+		keys, err := watcher.Load()
+		require.NoError(t, err)
+		ts, err := token.New(keys, cfg)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- watcher.Run(ctx, ts) }()
+
+		b := writeKey(t, dir, "b.pem", jwa.ES256)
+		assert.Eventually(t, func() bool {
+			_, findErr := ts.FindKey(b, "")
+			return findErr == nil
+		}, time.Second, 10*time.Millisecond)
+
+		cancel()
+		require.NoError(t, <-done)
+	})
+
+	t.Run("returns immediately if no interval is configured", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		writeKey(t, dir, "a.pem", jwa.ES256)
+		watcher, ts := makeWatcher(t, dir)
+
+		require.NoError(t, watcher.Run(context.Background(), ts))
+	})
+}
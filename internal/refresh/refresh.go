@@ -0,0 +1,156 @@
+package refresh
+
+import (
+	"crypto/rand"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidToken is returned when a refresh token is unknown, expired,
+	// revoked or was issued to another client.
+	ErrInvalidToken = errors.New("invalid or expired refresh token")
+
+	// ErrTokenReused is returned when a refresh token that was already
+	// rotated is used again. The whole token family is revoked.
+	ErrTokenReused = errors.New("refresh token reuse detected")
+)
+
+// Grant is the authorization bound to a refresh token.
+type Grant struct {
+	ClientID string
+	Scopes   []string
+	Claims   map[string]interface{}
+	AuthTime time.Time
+}
+
+type entry struct {
+	grant     Grant
+	family    string
+	rotated   bool
+	expiresAt time.Time
+}
+
+// Store holds the refresh tokens issued by the server. Tokens obtained by
+// rotating the same original token belong to the same family, which is
+// revoked as a whole when a rotated token is reused.
+type Store struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	tokens  map[string]*entry
+	revoked map[string]time.Time
+}
+
+func New(ttl time.Duration) *Store {
+	return &Store{ttl: ttl, tokens: map[string]*entry{}, revoked: map[string]time.Time{}}
+}
+
+// Issue returns a new refresh token for the grant, starting a new family.
+func (s *Store) Issue(grant Grant) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune()
+	return s.issue(grant, rand.Text())
+}
+
+// Lookup returns the grant of a refresh token issued to the client, leaving
+// the token untouched so that the request can be validated before the token
+// is rotated.
+func (s *Store) Lookup(token, clientID string) (Grant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, err := s.find(token, clientID)
+	if err != nil {
+		return Grant{}, err
+	}
+
+	return e.grant, nil
+}
+
+// Rotate replaces a refresh token issued to the client by a new one in the
+// same family. The token can no longer be used afterwards.
+func (s *Store) Rotate(token, clientID string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, err := s.find(token, clientID)
+	if err != nil {
+		return "", err
+	}
+
+	e.rotated = true
+	return s.issue(e.grant, e.family), nil
+}
+
+// Revoke revokes the family of a refresh token. It reports whether the token
+// was issued by the store.
+func (s *Store) Revoke(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, exists := s.tokens[token]
+	if exists {
+		s.revokeFamily(e.family)
+	}
+
+	return exists
+}
+
+// find returns the entry of a usable refresh token. Reusing a rotated token
+// revokes its family.
+func (s *Store) find(token, clientID string) (*entry, error) {
+	s.prune()
+
+	e, exists := s.tokens[token]
+	if !exists || e.grant.ClientID != clientID {
+		return nil, ErrInvalidToken
+	}
+
+	if _, revoked := s.revoked[e.family]; revoked {
+		return nil, ErrInvalidToken
+	}
+
+	if e.rotated {
+		s.revokeFamily(e.family)
+		return nil, ErrTokenReused
+	}
+
+	return e, nil
+}
+
+func (s *Store) issue(grant Grant, family string) string {
+	token := rand.Text()
+	s.tokens[token] = &entry{grant: grant, family: family, expiresAt: time.Now().Add(s.ttl)}
+	return token
+}
+
+// revokeFamily marks the family as revoked until its last token expires.
+func (s *Store) revokeFamily(family string) {
+	var expiresAt time.Time
+	for _, e := range s.tokens {
+		if e.family == family && e.expiresAt.After(expiresAt) {
+			expiresAt = e.expiresAt
+		}
+	}
+
+	s.revoked[family] = expiresAt
+}
+
+func (s *Store) prune() {
+	now := time.Now()
+
+	for token, e := range s.tokens {
+		if e.expiresAt.Before(now) {
+			delete(s.tokens, token)
+		}
+	}
+
+	for family, expiresAt := range s.revoked {
+		if expiresAt.Before(now) {
+			delete(s.revoked, family)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package refresh_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/murar8/local-jwks-server/internal/refresh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	grant := refresh.Grant{ClientID: "client", Scopes: []string{"read"}}
+
+	t.Run("returns the same token without rotation", func(t *testing.T) {
+		t.Parallel()
+
+		s := refresh.New(time.Hour)
+		token := s.Issue(grant)
+
+		for range 2 {
+			g, err := s.Lookup(token, "client")
+			require.NoError(t, err)
+			assert.Equal(t, grant, g)
+		}
+	})
+
+	t.Run("rotates the token on use", func(t *testing.T) {
+		t.Parallel()
+
+		s := refresh.New(time.Hour)
+		token := s.Issue(grant)
+
+		next, err := s.Rotate(token, "client")
+		require.NoError(t, err)
+		assert.NotEqual(t, token, next)
+
+		g, err := s.Lookup(next, "client")
+		require.NoError(t, err)
+		assert.Equal(t, grant, g)
+	})
+
+	t.Run("revokes the family when a rotated token is reused", func(t *testing.T) {
+		t.Parallel()
+
+		s := refresh.New(time.Hour)
+		token := s.Issue(grant)
+		other := s.Issue(grant)
+
+		next, err := s.Rotate(token, "client")
+		require.NoError(t, err)
+
+		_, err = s.Lookup(token, "client")
+		require.ErrorIs(t, err, refresh.ErrTokenReused)
+
+		_, err = s.Rotate(next, "client")
+		require.ErrorIs(t, err, refresh.ErrInvalidToken)
+
+		_, err = s.Rotate(other, "client")
+		require.NoError(t, err)
+	})
+
+	t.Run("rejects tokens of other clients", func(t *testing.T) {
+		t.Parallel()
+
+		s := refresh.New(time.Hour)
+		token := s.Issue(grant)
+
+		_, err := s.Rotate(token, "other")
+		require.ErrorIs(t, err, refresh.ErrInvalidToken)
+
+		// The token is left untouched.
+		_, err = s.Rotate(token, "client")
+		require.NoError(t, err)
+	})
+
+	t.Run("rejects expired tokens", func(t *testing.T) {
+		t.Parallel()
+
+		s := refresh.New(-time.Second)
+		token := s.Issue(grant)
+
+		_, err := s.Lookup(token, "client")
+		require.ErrorIs(t, err, refresh.ErrInvalidToken)
+	})
+
+	t.Run("revokes a token family", func(t *testing.T) {
+		t.Parallel()
+
+		s := refresh.New(time.Hour)
+		token := s.Issue(grant)
+
+		assert.True(t, s.Revoke(token))
+		assert.False(t, s.Revoke("unknown"))
+
+		_, err := s.Lookup(token, "client")
+		require.ErrorIs(t, err, refresh.ErrInvalidToken)
+	})
+}
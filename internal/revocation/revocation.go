@@ -0,0 +1,55 @@
+package revocation
+
+import (
+	"sync"
+	"time"
+)
+
+// Store is an in-memory list of revoked token IDs. Entries are kept until the
+// token would have expired anyway.
+type Store struct {
+	mu      sync.RWMutex
+	revoked map[string]time.Time
+}
+
+func New() *Store {
+	return &Store{revoked: map[string]time.Time{}}
+}
+
+// Revoke adds a token ID to the list. A zero expiration time keeps the entry
+// forever.
+func (s *Store) Revoke(jti string, exp time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune()
+	s.revoked[jti] = exp
+}
+
+// IsRevoked reports whether the token ID has been revoked.
+func (s *Store) IsRevoked(jti string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, exists := s.revoked[jti]
+	return exists
+}
+
+// Len returns the number of revoked tokens that have not expired yet.
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune()
+	return len(s.revoked)
+}
+
+func (s *Store) prune() {
+	now := time.Now()
+
+	for jti, exp := range s.revoked {
+		if !exp.IsZero() && exp.Before(now) {
+			delete(s.revoked, jti)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package revocation_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/murar8/local-jwks-server/internal/revocation"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	t.Run("reports revoked tokens", func(t *testing.T) {
+		t.Parallel()
+
+		s := revocation.New()
+		s.Revoke("revoked", time.Now().Add(time.Hour))
+
+		assert.True(t, s.IsRevoked("revoked"))
+		assert.False(t, s.IsRevoked("other"))
+	})
+
+	t.Run("forgets tokens once they expire", func(t *testing.T) {
+		t.Parallel()
+
+		s := revocation.New()
+		s.Revoke("expired", time.Now().Add(-time.Second))
+		s.Revoke("active", time.Now().Add(time.Hour))
+		s.Revoke("forever", time.Time{})
+
+		assert.Equal(t, 2, s.Len())
+		assert.False(t, s.IsRevoked("expired"))
+		assert.True(t, s.IsRevoked("forever"))
+	})
+}
@@ -0,0 +1,209 @@
+package rotation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/murar8/local-jwks-server/internal/config"
+	"github.com/murar8/local-jwks-server/internal/token"
+)
+
+// maxRetiredKeys is the number of retired keys kept in the rotation status.
+const maxRetiredKeys = 16
+
+// PreviousKey is a key that has been rotated out but is still published for
+// verification until its grace period ends.
+type PreviousKey struct {
+	KeyID     string    `json:"kid"`
+	RotatedAt time.Time `json:"rotated_at"`
+	RetiresAt time.Time `json:"retires_at"`
+}
+
+// RetiredKey is a key that has been removed from the key set.
+type RetiredKey struct {
+	KeyID     string    `json:"kid"`
+	RetiredAt time.Time `json:"retired_at"`
+}
+
+// Status is a snapshot of the rotation state.
+type Status struct {
+	Current      string        `json:"current"`
+	Previous     []PreviousKey `json:"previous"`
+	Retired      []RetiredKey  `json:"retired"`
+	LastRotation *time.Time    `json:"last_rotation,omitempty"`
+	NextRotation *time.Time    `json:"next_rotation,omitempty"`
+}
+
+// Rotator replaces the default key of a token service with a freshly
+// generated one, keeping the previous key published for a grace period.
+type Rotator struct {
+	mu           sync.Mutex
+	tokenService token.Service
+	interval     time.Duration
+	gracePeriod  time.Duration
+	rsaKeySize   int
+	previous     []PreviousKey
+	retired      []RetiredKey
+	lastRotation *time.Time
+	nextRotation *time.Time
+}
+
+func New(tokenService token.Service, cfg *config.Rotation, rsaKeySize int) *Rotator {
+	return &Rotator{
+		tokenService: tokenService,
+		interval:     cfg.Interval,
+		gracePeriod:  cfg.GracePeriod,
+		rsaKeySize:   rsaKeySize,
+		previous:     []PreviousKey{},
+		retired:      []RetiredKey{},
+	}
+}
+
+// Run rotates the default key every configured interval until the context is
+// canceled. Failed rotations are logged. It returns immediately if no
+// interval is configured.
+func (r *Rotator) Run(ctx context.Context) error {
+	if r.interval <= 0 {
+		return nil
+	}
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	r.scheduleNext()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			// A failed rotation keeps the current key and is retried on the
+			// next tick.
+			if _, err := r.Rotate(); err != nil {
+				log.Printf("failed to rotate key: %s", err)
+			}
+			r.scheduleNext()
+		}
+	}
+}
+
+// Rotate generates a new key with the same algorithm and key operations as
+// the current default key and starts signing with it. The replaced key is
+// retired once the grace period has elapsed.
+func (r *Rotator) Rotate() (jwk.Key, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current := r.tokenService.GetKey()
+	alg := jwa.SignatureAlgorithm(current.Algorithm().String())
+
+	raw, err := token.GeneratePrivateKey(alg, r.rsaKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	key, err := token.NewKey(raw, &config.Key{Alg: alg, KeyOps: current.KeyOps()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create key: %w", err)
+	}
+
+	// Consumers looking up keys by certificate expect every key to have one.
+	if _, hasCert := current.Get(jwk.X509CertChainKey); hasCert {
+		if err = token.EnsureCertificate(key); err != nil {
+			return nil, fmt.Errorf("failed to create certificate: %w", err)
+		}
+	}
+
+	if err = r.tokenService.AddKey(key); err != nil {
+		return nil, fmt.Errorf("failed to add key: %w", err)
+	}
+
+	if err = r.tokenService.SetDefaultKey(key.KeyID()); err != nil {
+		return nil, fmt.Errorf("failed to set default key: %w", err)
+	}
+
+	now := time.Now()
+	r.lastRotation = &now
+
+	// Keys that could not be retired when due are retried now that the
+	// default key changed. A previous key promoted back to default gets a
+	// new grace period.
+	r.retireDue(now)
+	r.previous = slices.DeleteFunc(r.previous, func(prev PreviousKey) bool { return prev.KeyID == current.KeyID() })
+
+	r.previous = append(r.previous, PreviousKey{
+		KeyID:     current.KeyID(),
+		RotatedAt: now,
+		RetiresAt: now.Add(r.gracePeriod),
+	})
+
+	time.AfterFunc(r.gracePeriod, r.retire)
+
+	return key, nil
+}
+
+// Status returns a snapshot of the current rotation state.
+func (r *Rotator) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return Status{
+		Current:      r.tokenService.GetKey().KeyID(),
+		Previous:     append([]PreviousKey{}, r.previous...),
+		Retired:      append([]RetiredKey{}, r.retired...),
+		LastRotation: r.lastRotation,
+		NextRotation: r.nextRotation,
+	}
+}
+
+func (r *Rotator) scheduleNext() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next := time.Now().Add(r.interval)
+	r.nextRotation = &next
+}
+
+func (r *Rotator) retire() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.retireDue(time.Now())
+}
+
+// retireDue removes the previous keys whose grace period has ended.
+func (r *Rotator) retireDue(now time.Time) {
+	r.previous = slices.DeleteFunc(r.previous, func(prev PreviousKey) bool {
+		return !prev.RetiresAt.After(now) && r.remove(prev.KeyID)
+	})
+}
+
+// remove removes a key from the key set and reports whether it can be
+// dropped from the previous keys. A key that was promoted back to default
+// must stay published, so it is kept to be retried on the next rotation. A
+// key that was already removed, e.g. through the admin API, is dropped
+// without being reported as retired.
+func (r *Rotator) remove(kid string) bool {
+	err := r.tokenService.RemoveKey(kid)
+	if errors.Is(err, token.ErrKeyNotFound) {
+		return true
+	}
+	if err != nil {
+		return false
+	}
+
+	r.retired = append(r.retired, RetiredKey{KeyID: kid, RetiredAt: time.Now()})
+
+	if len(r.retired) > maxRetiredKeys {
+		r.retired = r.retired[len(r.retired)-maxRetiredKeys:]
+	}
+
+	return true
+}
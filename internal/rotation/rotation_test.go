@@ -0,0 +1,258 @@
+package rotation_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/murar8/local-jwks-server/internal/config"
+	"github.com/murar8/local-jwks-server/internal/rotation"
+	"github.com/murar8/local-jwks-server/internal/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeTokenService(t *testing.T) token.Service {
+	t.Helper()
+
+	cfg := config.JWK{Alg: jwa.ES256, KeyID: "initial", KeyOps: jwk.KeyOperationList{"sign", "verify"}}
+	raw, err := token.GeneratePrivateKey(cfg.Alg, 2048)
+	require.NoError(t, err)
+
+	ts, err := token.FromRawKey(raw, &cfg)
+	require.NoError(t, err)
+
+	return ts
+}
+
+// failingService fails to add the first key.
+type failingService struct {
+	token.Service
+
+	mu     sync.Mutex
+	failed bool
+}
+
+func (s *failingService) AddKey(key jwk.Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.failed {
+		s.failed = true
+		return errors.New("failed to add key")
+	}
+
+	return s.Service.AddKey(key)
+}
+
+func TestRotate(t *testing.T) {
+	t.Parallel()
+
+	t.Run("replaces the default key with a new key", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeTokenService(t)
+		r := rotation.New(ts, &config.Rotation{GracePeriod: time.Hour}, 2048)
+
+		key, err := r.Rotate()
+		require.NoError(t, err)
+
+		assert.NotEqual(t, "initial", key.KeyID())
+		assert.Equal(t, key.KeyID(), ts.GetKey().KeyID())
+		assert.Equal(t, jwa.ES256, key.Algorithm())
+		assert.Equal(t, jwk.KeyOperationList{"sign", "verify"}, key.KeyOps())
+
+		status := r.Status()
+		assert.Equal(t, key.KeyID(), status.Current)
+		require.Len(t, status.Previous, 1)
+		assert.Equal(t, "initial", status.Previous[0].KeyID)
+		assert.Empty(t, status.Retired)
+		assert.NotNil(t, status.LastRotation)
+	})
+
+	t.Run("keeps the previous key published during the grace period", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeTokenService(t)
+		r := rotation.New(ts, &config.Rotation{GracePeriod: time.Hour}, 2048)
+
+		signed, err := ts.SignToken(map[string]interface{}{"sub": "john-doe"})
+		require.NoError(t, err)
+
+		_, err = r.Rotate()
+		require.NoError(t, err)
+
+		set, err := ts.GetKeySet()
+		require.NoError(t, err)
+		assert.Equal(t, 2, set.Len())
+
+		_, err = jwt.Parse(signed, jwt.WithKeySet(set))
+		require.NoError(t, err)
+	})
+
+	t.Run("retires the previous key after the grace period", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeTokenService(t)
+		r := rotation.New(ts, &config.Rotation{GracePeriod: 10 * time.Millisecond}, 2048)
+
+		key, err := r.Rotate()
+		require.NoError(t, err)
+
+		assert.Eventually(t, func() bool {
+			return len(r.Status().Retired) == 1
+		}, time.Second, 5*time.Millisecond)
+
+		status := r.Status()
+		assert.Equal(t, "initial", status.Retired[0].KeyID)
+		assert.Empty(t, status.Previous)
+		require.Len(t, ts.GetKeys(), 1)
+		assert.Equal(t, key.KeyID(), ts.GetKeys()[0].KeyID())
+	})
+
+	t.Run("keeps a previous key promoted back to default until the next rotation", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeTokenService(t)
+		r := rotation.New(ts, &config.Rotation{GracePeriod: 10 * time.Millisecond}, 2048)
+
+		key, err := r.Rotate()
+		require.NoError(t, err)
+		require.NoError(t, ts.SetDefaultKey("initial"))
+
+		time.Sleep(50 * time.Millisecond)
+
+		status := r.Status()
+		require.Len(t, status.Previous, 1)
+		assert.Equal(t, "initial", status.Previous[0].KeyID)
+		assert.Empty(t, status.Retired)
+		assert.Len(t, ts.GetKeys(), 2)
+
+		require.NoError(t, ts.SetDefaultKey(key.KeyID()))
+		_, err = r.Rotate()
+		require.NoError(t, err)
+
+		status = r.Status()
+		require.Len(t, status.Retired, 1)
+		assert.Equal(t, "initial", status.Retired[0].KeyID)
+		require.Len(t, status.Previous, 1)
+		assert.Equal(t, key.KeyID(), status.Previous[0].KeyID)
+	})
+
+	t.Run("drops a previous key removed in the meantime without retiring it", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeTokenService(t)
+		r := rotation.New(ts, &config.Rotation{GracePeriod: 10 * time.Millisecond}, 2048)
+
+		_, err := r.Rotate()
+		require.NoError(t, err)
+		require.NoError(t, ts.RemoveKey("initial"))
+
+		assert.Eventually(t, func() bool {
+			return len(r.Status().Previous) == 0
+		}, time.Second, 5*time.Millisecond)
+		assert.Empty(t, r.Status().Retired)
+	})
+
+	t.Run("creates a certificate if the current key has one", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeTokenService(t)
+		require.NoError(t, token.EnsureCertificate(ts.GetKey()))
+		r := rotation.New(ts, &config.Rotation{GracePeriod: time.Hour}, 2048)
+
+		key, err := r.Rotate()
+		require.NoError(t, err)
+		assert.Equal(t, 1, key.X509CertChain().Len())
+	})
+
+	t.Run("is safe under concurrent use", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeTokenService(t)
+		r := rotation.New(ts, &config.Rotation{GracePeriod: time.Millisecond}, 2048)
+
+		var wg sync.WaitGroup
+		for range 10 {
+			wg.Add(3)
+			go func() {
+				defer wg.Done()
+				_, err := r.Rotate()
+				assert.NoError(t, err)
+			}()
+			go func() {
+				defer wg.Done()
+				_, err := ts.SignToken(map[string]interface{}{"sub": "john-doe"})
+				assert.NoError(t, err)
+			}()
+			go func() {
+				defer wg.Done()
+				_, err := ts.GetKeySet()
+				assert.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+
+		assert.Eventually(t, func() bool {
+			return len(ts.GetKeys()) == 1
+		}, time.Second, 5*time.Millisecond)
+	})
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	t.Run("rotates the key on every interval", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeTokenService(t)
+		r := rotation.New(ts, &config.Rotation{Interval: 10 * time.Millisecond, GracePeriod: time.Hour}, 2048)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- r.Run(ctx) }()
+
+		assert.Eventually(t, func() bool {
+			return len(r.Status().Previous) >= 2
+		}, time.Second, 5*time.Millisecond)
+
+		cancel()
+		require.NoError(t, <-done)
+		assert.NotNil(t, r.Status().NextRotation)
+	})
+
+	t.Run("keeps rotating after a failed rotation", func(t *testing.T) {
+		t.Parallel()
+
+		ts := &failingService{Service: makeTokenService(t)}
+		r := rotation.New(ts, &config.Rotation{Interval: 10 * time.Millisecond, GracePeriod: time.Hour}, 2048)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- r.Run(ctx) }()
+
+		assert.Eventually(t, func() bool {
+			return len(r.Status().Previous) >= 1
+		}, time.Second, 5*time.Millisecond)
+
+		cancel()
+		require.NoError(t, <-done)
+		assert.True(t, ts.failed)
+		assert.NotEqual(t, "initial", ts.GetKey().KeyID())
+	})
+
+	t.Run("returns immediately if rotation is disabled", func(t *testing.T) {
+		t.Parallel()
+
+		r := rotation.New(makeTokenService(t), &config.Rotation{}, 2048)
+
+		require.NoError(t, r.Run(context.Background()))
+		assert.Nil(t, r.Status().NextRotation)
+	})
+}
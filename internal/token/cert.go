@@ -0,0 +1,206 @@
+package token
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec // x5t is defined by RFC 7517 as a SHA-1 thumbprint.
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/cert"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+)
+
+// certificatePEMType is the PEM block type of X.509 certificates.
+const certificatePEMType = "CERTIFICATE"
+
+// selfSignedValidity is the validity period of self-signed certificates.
+const selfSignedValidity = 10 * 365 * 24 * time.Hour
+
+// serialNumberBits is the size of the random serial number of self-signed
+// certificates.
+const serialNumberBits = 128
+
+var (
+	// ErrInvalidCertificate is returned when a certificate chain cannot be
+	// parsed or is not correctly ordered.
+	ErrInvalidCertificate = errors.New("invalid certificate")
+
+	// ErrCertificateMismatch is returned when the leaf certificate does not
+	// match the key it is attached to.
+	ErrCertificateMismatch = errors.New("certificate does not match the key")
+)
+
+// ParseCertificateChain parses the certificates from PEM data, starting with
+// the leaf certificate. Blocks other than certificates are ignored.
+func ParseCertificateChain(data []byte) ([]*x509.Certificate, error) {
+	chain, err := parseCertificates(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidCertificate, "no certificate found")
+	}
+
+	return chain, nil
+}
+
+// SetCertificateChain publishes the certificate chain of a key in the x5c,
+// x5t and x5t#S256 fields. The leaf certificate must match the key and every
+// certificate must be signed by the next one in the chain.
+func SetCertificateChain(key jwk.Key, chain []*x509.Certificate) error {
+	if len(chain) == 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidCertificate, "empty certificate chain")
+	}
+
+	if err := verifyLeaf(key, chain[0]); err != nil {
+		return err
+	}
+
+	for i := range len(chain) - 1 {
+		if err := chain[i].CheckSignatureFrom(chain[i+1]); err != nil {
+			return fmt.Errorf("%w: certificate %d is not signed by the next one: %w", ErrInvalidCertificate, i, err)
+		}
+	}
+
+	var x5c cert.Chain
+	for _, c := range chain {
+		_ = x5c.AddString(base64.StdEncoding.EncodeToString(c.Raw))
+	}
+
+	x5t := sha1.Sum(chain[0].Raw) //nolint:gosec // See the import comment.
+	x5tS256 := sha256.Sum256(chain[0].Raw)
+
+	fields := map[string]interface{}{
+		jwk.X509CertChainKey:          &x5c,
+		jwk.X509CertThumbprintKey:     base64.RawURLEncoding.EncodeToString(x5t[:]),
+		jwk.X509CertThumbprintS256Key: base64.RawURLEncoding.EncodeToString(x5tS256[:]),
+	}
+
+	for name, val := range fields {
+		if err := key.Set(name, val); err != nil {
+			return fmt.Errorf("failed to set key field: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// AttachCertificateChain sets the certificate chain on the key matching the
+// leaf certificate, see SetCertificateChain. The other keys are left
+// unchanged, and ErrCertificateMismatch is returned if no key matches.
+func AttachCertificateChain(keys []jwk.Key, chain []*x509.Certificate) error {
+	for _, key := range keys {
+		if err := SetCertificateChain(key, chain); !errors.Is(err, ErrCertificateMismatch) {
+			return err
+		}
+	}
+
+	return fmt.Errorf("%w: no key matches the leaf certificate", ErrCertificateMismatch)
+}
+
+// SelfSignedCertificate creates a self-signed certificate for a private key.
+func SelfSignedCertificate(key jwk.Key) (*x509.Certificate, error) {
+	var raw interface{}
+	if err := key.Raw(&raw); err != nil {
+		return nil, fmt.Errorf("failed to get raw key: %w", err)
+	}
+
+	signer, ok := raw.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: expected an asymmetric private key", ErrWrongKeyType)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), serialNumberBits))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: key.KeyID()},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, signer.Public(), signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	return c, nil
+}
+
+// EnsureCertificate attaches a self-signed certificate to an asymmetric key
+// without a certificate chain.
+func EnsureCertificate(key jwk.Key) error {
+	if _, exists := key.Get(jwk.X509CertChainKey); exists || IsSymmetric(key) {
+		return nil
+	}
+
+	c, err := SelfSignedCertificate(key)
+	if err != nil {
+		return err
+	}
+
+	return SetCertificateChain(key, []*x509.Certificate{c})
+}
+
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var chain []*x509.Certificate
+
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			break
+		}
+
+		if block.Type != certificatePEMType {
+			continue
+		}
+
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidCertificate, err)
+		}
+
+		chain = append(chain, c)
+	}
+
+	return chain, nil
+}
+
+func verifyLeaf(key jwk.Key, leaf *x509.Certificate) error {
+	pk, err := key.PublicKey()
+	if err != nil {
+		return fmt.Errorf("failed to get public key: %w", err)
+	}
+
+	var raw interface{}
+	if err = pk.Raw(&raw); err != nil {
+		return fmt.Errorf("failed to get raw public key: %w", err)
+	}
+
+	pub, ok := raw.(interface{ Equal(x crypto.PublicKey) bool })
+	if !ok || !pub.Equal(leaf.PublicKey) {
+		return ErrCertificateMismatch
+	}
+
+	return nil
+}
@@ -0,0 +1,277 @@
+package token_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/murar8/local-jwks-server/internal/config"
+	"github.com/murar8/local-jwks-server/internal/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCertificate(t *testing.T, pub, signer interface{}, parent *x509.Certificate, isCA bool) *x509.Certificate {
+	t.Helper()
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if parent == nil {
+		parent = template
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, signer)
+	require.NoError(t, err)
+
+	c, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return c
+}
+
+func encodeCertificates(chain ...*x509.Certificate) []byte {
+	var data []byte
+	for _, c := range chain {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	}
+	return data
+}
+
+func newCertChain(t *testing.T) (*ecdsa.PrivateKey, []*x509.Certificate) {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ca := newCertificate(t, &caKey.PublicKey, caKey, nil, true)
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	leaf := newCertificate(t, &leafKey.PublicKey, caKey, ca, false)
+
+	return leafKey, []*x509.Certificate{leaf, ca}
+}
+
+func TestParseCertificateChain(t *testing.T) {
+	t.Parallel()
+
+	t.Run("parses the certificates in order", func(t *testing.T) {
+		t.Parallel()
+
+		_, chain := newCertChain(t)
+
+		parsed, err := token.ParseCertificateChain(encodeCertificates(chain...))
+		require.NoError(t, err)
+		require.Len(t, parsed, 2)
+		assert.Equal(t, chain[0].Raw, parsed[0].Raw)
+		assert.Equal(t, chain[1].Raw, parsed[1].Raw)
+	})
+
+	t.Run("returns an error if there are no certificates", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := token.ParseCertificateChain([]byte("not a certificate"))
+		require.ErrorIs(t, err, token.ErrInvalidCertificate)
+	})
+}
+
+func TestSetCertificateChain(t *testing.T) {
+	t.Parallel()
+
+	t.Run("publishes the chain and thumbprints", func(t *testing.T) {
+		t.Parallel()
+
+		raw, chain := newCertChain(t)
+		key, err := token.NewKey(raw, &config.Key{Alg: jwa.ES256})
+		require.NoError(t, err)
+
+		require.NoError(t, token.SetCertificateChain(key, chain))
+
+		x5c := key.X509CertChain()
+		require.Equal(t, 2, x5c.Len())
+		leaf, _ := x5c.Get(0)
+		assert.Equal(t, base64.StdEncoding.EncodeToString(chain[0].Raw), string(leaf))
+
+		sum := sha256.Sum256(chain[0].Raw)
+		assert.Equal(t, base64.RawURLEncoding.EncodeToString(sum[:]), key.X509CertThumbprintS256())
+		assert.NotEmpty(t, key.X509CertThumbprint())
+	})
+
+	t.Run("returns an error if the certificate does not match the key", func(t *testing.T) {
+		t.Parallel()
+
+		_, chain := newCertChain(t)
+		raw, err := token.GeneratePrivateKey(jwa.ES256, 0)
+		require.NoError(t, err)
+		key, err := token.NewKey(raw, &config.Key{Alg: jwa.ES256})
+		require.NoError(t, err)
+
+		err = token.SetCertificateChain(key, chain)
+		require.ErrorIs(t, err, token.ErrCertificateMismatch)
+	})
+
+	t.Run("returns an error if the chain is not ordered", func(t *testing.T) {
+		t.Parallel()
+
+		raw, chain := newCertChain(t)
+		key, err := token.NewKey(raw, &config.Key{Alg: jwa.ES256})
+		require.NoError(t, err)
+
+		other, _ := newCertChain(t)
+		issuer := newCertificate(t, &other.PublicKey, other, nil, true)
+
+		err = token.SetCertificateChain(key, []*x509.Certificate{chain[0], issuer})
+		require.ErrorIs(t, err, token.ErrInvalidCertificate)
+	})
+}
+
+func TestAttachCertificateChain(t *testing.T) {
+	t.Parallel()
+
+	newKey := func(t *testing.T, raw interface{}) jwk.Key {
+		t.Helper()
+
+		key, err := token.NewKey(raw, &config.Key{Alg: jwa.ES256})
+		require.NoError(t, err)
+		return key
+	}
+
+	t.Run("attaches the chain only to the matching key", func(t *testing.T) {
+		t.Parallel()
+
+		raw, chain := newCertChain(t)
+		other, _ := token.GeneratePrivateKey(jwa.ES256, 0)
+		keys := []jwk.Key{newKey(t, other), newKey(t, raw)}
+
+		require.NoError(t, token.AttachCertificateChain(keys, chain))
+		assert.Nil(t, keys[0].X509CertChain())
+		assert.Equal(t, 2, keys[1].X509CertChain().Len())
+	})
+
+	t.Run("returns an error if no key matches the leaf certificate", func(t *testing.T) {
+		t.Parallel()
+
+		_, chain := newCertChain(t)
+		other, _ := token.GeneratePrivateKey(jwa.ES256, 0)
+
+		err := token.AttachCertificateChain([]jwk.Key{newKey(t, other)}, chain)
+		require.ErrorIs(t, err, token.ErrCertificateMismatch)
+	})
+}
+
+func TestEnsureCertificate(t *testing.T) {
+	t.Parallel()
+
+	algs := []jwa.SignatureAlgorithm{jwa.RS256, jwa.ES256, jwa.EdDSA}
+
+	for _, alg := range algs {
+		t.Run("creates a self-signed certificate for "+alg.String(), func(t *testing.T) {
+			t.Parallel()
+
+			raw, err := token.GeneratePrivateKey(alg, 2048)
+			require.NoError(t, err)
+			key, err := token.NewKey(raw, &config.Key{Alg: alg})
+			require.NoError(t, err)
+
+			require.NoError(t, token.EnsureCertificate(key))
+
+			x5c := key.X509CertChain()
+			require.Equal(t, 1, x5c.Len())
+
+			encoded, _ := x5c.Get(0)
+			der, err := base64.StdEncoding.DecodeString(string(encoded))
+			require.NoError(t, err)
+			c, err := x509.ParseCertificate(der)
+			require.NoError(t, err)
+			assert.Equal(t, key.KeyID(), c.Subject.CommonName)
+			require.NoError(t, c.CheckSignature(c.SignatureAlgorithm, c.RawTBSCertificate, c.Signature))
+		})
+	}
+
+	t.Run("keeps an existing certificate chain", func(t *testing.T) {
+		t.Parallel()
+
+		raw, chain := newCertChain(t)
+		key, err := token.NewKey(raw, &config.Key{Alg: jwa.ES256})
+		require.NoError(t, err)
+		require.NoError(t, token.SetCertificateChain(key, chain))
+
+		require.NoError(t, token.EnsureCertificate(key))
+		assert.Equal(t, 2, key.X509CertChain().Len())
+	})
+
+	t.Run("ignores HMAC keys", func(t *testing.T) {
+		t.Parallel()
+
+		raw, err := token.GeneratePrivateKey(jwa.HS256, 0)
+		require.NoError(t, err)
+		key, err := token.NewKey(raw, &config.Key{Alg: jwa.HS256})
+		require.NoError(t, err)
+
+		require.NoError(t, token.EnsureCertificate(key))
+		_, exists := key.Get(jwk.X509CertChainKey)
+		assert.False(t, exists)
+	})
+}
+
+func TestParsePrivateKeyWithCertificate(t *testing.T) {
+	t.Parallel()
+
+	t.Run("attaches the certificate chain bundled with the key", func(t *testing.T) {
+		t.Parallel()
+
+		raw, chain := newCertChain(t)
+		der, err := x509.MarshalPKCS8PrivateKey(raw)
+		require.NoError(t, err)
+
+		data := encodeCertificates(chain...)
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})...)
+
+		parsed, err := token.ParsePrivateKey(data, jwa.ES256)
+		require.NoError(t, err)
+
+		key, err := token.NewKey(parsed, &config.Key{Alg: jwa.ES256})
+		require.NoError(t, err)
+		assert.Equal(t, 2, key.X509CertChain().Len())
+	})
+}
+
+func TestGetKeySetCertificate(t *testing.T) {
+	t.Parallel()
+
+	t.Run("publishes the certificate chain of public keys", func(t *testing.T) {
+		t.Parallel()
+
+		raw, chain := newCertChain(t)
+		key, err := token.NewKey(raw, &config.Key{Alg: jwa.ES256})
+		require.NoError(t, err)
+		require.NoError(t, token.SetCertificateChain(key, chain))
+
+		ts, err := token.New([]jwk.Key{key}, &config.JWK{Alg: jwa.ES256})
+		require.NoError(t, err)
+
+		set, err := ts.GetKeySet()
+		require.NoError(t, err)
+		pub, ok := set.Key(0)
+		require.True(t, ok)
+
+		assert.Equal(t, 2, pub.X509CertChain().Len())
+		assert.Equal(t, key.X509CertThumbprintS256(), pub.X509CertThumbprintS256())
+	})
+}
@@ -0,0 +1,52 @@
+package token
+
+import (
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/murar8/local-jwks-server/internal/config"
+)
+
+// setDefaultClaims fills in the registered claims missing from the token. The
+// expiration and not before times are relative to the issued at time, which
+// defaults to the current time.
+func setDefaultClaims(t jwt.Token, claims *config.Claims) error {
+	if _, exists := t.Get(jwt.IssuedAtKey); !exists {
+		// Registered times are serialized with second precision.
+		if err := t.Set(jwt.IssuedAtKey, time.Now().Truncate(time.Second)); err != nil {
+			return fmt.Errorf("failed to set default claims: %w", err)
+		}
+	}
+
+	iat := t.IssuedAt()
+	defaults := map[string]interface{}{
+		jwt.NotBeforeKey: iat.Add(-claims.NotBeforeSkew),
+	}
+
+	if claims.TTL > 0 {
+		defaults[jwt.ExpirationKey] = iat.Add(claims.TTL)
+	}
+	if claims.Issuer != "" {
+		defaults[jwt.IssuerKey] = claims.Issuer
+	}
+	if len(claims.Audience) > 0 {
+		defaults[jwt.AudienceKey] = claims.Audience
+	}
+	if claims.JTI {
+		defaults[jwt.JwtIDKey] = rand.Text()
+	}
+
+	for name, val := range defaults {
+		if _, exists := t.Get(name); exists {
+			continue
+		}
+
+		if err := t.Set(name, val); err != nil {
+			return fmt.Errorf("failed to set default claims: %w", err)
+		}
+	}
+
+	return nil
+}
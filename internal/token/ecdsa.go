@@ -25,6 +25,11 @@ func AlgorithmToECDSACurve(alg jwa.SignatureAlgorithm) (elliptic.Curve, error) {
 		curve = elliptic.P384()
 	case jwa.ES512:
 		curve = elliptic.P521()
+	case jwa.ES256K:
+		var ok bool
+		if curve, ok = secp256k1Curve(); !ok {
+			err = fmt.Errorf("%w: %s", ErrUnsupportedCurve, alg)
+		}
 	default:
 		err = fmt.Errorf("%w: %s", ErrUnsupportedCurve, alg)
 	}
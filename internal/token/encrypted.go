@@ -0,0 +1,182 @@
+package token
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/sha1" //nolint:gosec // SHA-1 is the PBKDF2 default PRF defined by RFC 8018.
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// encryptedPEMType is the PEM block type of PKCS#8 encrypted private keys.
+const encryptedPEMType = "ENCRYPTED PRIVATE KEY"
+
+const (
+	oidPBES2        = "1.2.840.113549.1.5.13"
+	oidPBKDF2       = "1.2.840.113549.1.5.12"
+	oidHMACSHA1     = "1.2.840.113549.2.7"
+	oidHMACSHA224   = "1.2.840.113549.2.8"
+	oidHMACSHA256   = "1.2.840.113549.2.9"
+	oidHMACSHA384   = "1.2.840.113549.2.10"
+	oidHMACSHA512   = "1.2.840.113549.2.11"
+	oidAES128CBC    = "2.16.840.1.101.3.4.1.2"
+	oidAES192CBC    = "2.16.840.1.101.3.4.1.22"
+	oidAES256CBC    = "2.16.840.1.101.3.4.1.42"
+	aes128KeyLength = 16
+	aes192KeyLength = 24
+	aes256KeyLength = 32
+)
+
+var (
+	// ErrMissingPassphrase is returned when an encrypted key is parsed without
+	// a passphrase.
+	ErrMissingPassphrase = errors.New("missing passphrase for encrypted key")
+
+	// ErrIncorrectPassphrase is returned when an encrypted key cannot be
+	// decrypted with the provided passphrase.
+	ErrIncorrectPassphrase = errors.New("incorrect passphrase")
+
+	// ErrUnsupportedEncryption is returned when an encrypted key uses an
+	// unsupported encryption scheme.
+	ErrUnsupportedEncryption = errors.New("unsupported key encryption")
+)
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// decryptPKCS8 decrypts a PKCS#8 EncryptedPrivateKeyInfo structure using the
+// PBES2 scheme with PBKDF2 and AES-CBC, as produced by OpenSSL by default.
+func decryptPKCS8(der, passphrase []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPEM, err)
+	}
+
+	if info.Algorithm.Algorithm.String() != oidPBES2 {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncryption, info.Algorithm.Algorithm)
+	}
+
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPEM, err)
+	}
+
+	keyLength, err := cipherKeyLength(params.EncryptionScheme.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	var iv []byte
+	if _, err = asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPEM, err)
+	}
+
+	key, err := deriveKey(params.KeyDerivationFunc, passphrase, keyLength)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	data := info.EncryptedData
+	if len(iv) != block.BlockSize() || len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPEM, "invalid encrypted data")
+	}
+
+	plaintext := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, data)
+
+	// A wrong passphrase almost always results in invalid padding.
+	return unpad(plaintext, block.BlockSize())
+}
+
+func deriveKey(kdf pkix.AlgorithmIdentifier, passphrase []byte, keyLength int) ([]byte, error) {
+	if kdf.Algorithm.String() != oidPBKDF2 {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncryption, kdf.Algorithm)
+	}
+
+	var params pbkdf2Params
+	if _, err := asn1.Unmarshal(kdf.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPEM, err)
+	}
+
+	if params.KeyLength != 0 && params.KeyLength != keyLength {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPEM, "key length does not match cipher")
+	}
+
+	prf, err := pbkdf2Hash(params.PRF.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := pbkdf2.Key(prf, string(passphrase), params.Salt, params.IterationCount, keyLength)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+
+	return key, nil
+}
+
+func pbkdf2Hash(oid asn1.ObjectIdentifier) (func() hash.Hash, error) {
+	switch oid.String() {
+	// hmacWithSHA1 is the default when the PRF is omitted.
+	case "", oidHMACSHA1:
+		return sha1.New, nil
+	case oidHMACSHA224:
+		return sha256.New224, nil
+	case oidHMACSHA256:
+		return sha256.New, nil
+	case oidHMACSHA384:
+		return sha512.New384, nil
+	case oidHMACSHA512:
+		return sha512.New, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncryption, oid)
+	}
+}
+
+func cipherKeyLength(oid asn1.ObjectIdentifier) (int, error) {
+	switch oid.String() {
+	case oidAES128CBC:
+		return aes128KeyLength, nil
+	case oidAES192CBC:
+		return aes192KeyLength, nil
+	case oidAES256CBC:
+		return aes256KeyLength, nil
+	default:
+		return 0, fmt.Errorf("%w: %s", ErrUnsupportedEncryption, oid)
+	}
+}
+
+func unpad(data []byte, blockSize int) ([]byte, error) {
+	n := int(data[len(data)-1])
+	if n == 0 || n > blockSize || !bytes.Equal(data[len(data)-n:], bytes.Repeat([]byte{byte(n)}, n)) {
+		return nil, ErrIncorrectPassphrase
+	}
+
+	return data[:len(data)-n], nil
+}
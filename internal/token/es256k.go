@@ -0,0 +1,127 @@
+//go:build jwx_es256k
+
+package token
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// errNotSecp256k1 is returned when the DER data is not a secp256k1 key.
+var errNotSecp256k1 = errors.New("not a secp256k1 private key")
+
+// ecPrivateKey is the SEC1 private key structure, see RFC5915.
+type ecPrivateKey struct {
+	Version       int
+	PrivateKey    []byte
+	NamedCurveOID asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+	PublicKey     asn1.BitString        `asn1:"optional,explicit,tag:1"`
+}
+
+// pkcs8 is the PKCS#8 private key structure, see RFC5208.
+type pkcs8 struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+func secp256k1Curve() (elliptic.Curve, bool) {
+	return secp256k1.S256(), true
+}
+
+func secp256k1OID() asn1.ObjectIdentifier {
+	return asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+}
+
+func isSecp256k1(oid asn1.ObjectIdentifier) bool {
+	return oid.Equal(secp256k1OID())
+}
+
+// parseSecp256k1PrivateKey parses a secp256k1 private key in SEC1 or PKCS#8
+// form, since the standard library does not support the curve.
+func parseSecp256k1PrivateKey(der []byte) (*ecdsa.PrivateKey, error) {
+	var curveOID asn1.ObjectIdentifier
+
+	var p8 pkcs8
+	if _, err := asn1.Unmarshal(der, &p8); err == nil {
+		if _, err = asn1.Unmarshal(p8.Algo.Parameters.FullBytes, &curveOID); err != nil {
+			return nil, errNotSecp256k1
+		}
+		der = p8.PrivateKey
+	}
+
+	var key ecPrivateKey
+	if _, err := asn1.Unmarshal(der, &key); err != nil {
+		return nil, errNotSecp256k1
+	}
+
+	// The PKCS#8 wrapper already defines the curve, in which case the inner
+	// structure might omit it.
+	if key.NamedCurveOID != nil {
+		curveOID = key.NamedCurveOID
+	}
+
+	if !isSecp256k1(curveOID) {
+		return nil, errNotSecp256k1
+	}
+
+	return secp256k1.PrivKeyFromBytes(key.PrivateKey).ToECDSA(), nil
+}
+
+// marshalSecp256k1PrivateKey encodes a secp256k1 private key in PKCS#8 form.
+func marshalSecp256k1PrivateKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	if !isSecp256k1Curve(key.Curve) {
+		return nil, errNotSecp256k1
+	}
+
+	priv := secp256k1.PrivKeyFromBytes(key.D.Bytes())
+	d := priv.Key.Bytes()
+
+	inner, err := asn1.Marshal(ecPrivateKey{
+		Version:    1,
+		PrivateKey: d[:],
+		PublicKey:  asn1.BitString{Bytes: priv.PubKey().SerializeUncompressed()},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	params, err := asn1.Marshal(secp256k1OID())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal curve: %w", err)
+	}
+
+	der, err := asn1.Marshal(pkcs8{
+		Algo: pkix.AlgorithmIdentifier{
+			// id-ecPublicKey, see RFC5480.
+			Algorithm:  asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1},
+			Parameters: asn1.RawValue{FullBytes: params},
+		},
+		PrivateKey: inner,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	return der, nil
+}
+
+func isSecp256k1Curve(curve elliptic.Curve) bool {
+	return curve == secp256k1.S256()
+}
+
+// secp256k1PrivateKeyFromScalar builds a secp256k1 key from a big endian
+// scalar.
+func secp256k1PrivateKeyFromScalar(curve elliptic.Curve, scalar []byte) (*ecdsa.PrivateKey, error) {
+	if !isSecp256k1Curve(curve) {
+		return nil, errNotSecp256k1
+	}
+
+	return secp256k1.PrivKeyFromBytes(scalar).ToECDSA(), nil
+}
@@ -0,0 +1,29 @@
+//go:build !jwx_es256k
+
+package token
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+)
+
+// errES256KDisabled is returned when parsing a secp256k1 key without ES256K
+// support compiled in.
+var errES256KDisabled = errors.New("ES256K support requires the jwx_es256k build tag")
+
+func secp256k1Curve() (elliptic.Curve, bool) {
+	return nil, false
+}
+
+func parseSecp256k1PrivateKey([]byte) (*ecdsa.PrivateKey, error) {
+	return nil, errES256KDisabled
+}
+
+func marshalSecp256k1PrivateKey(*ecdsa.PrivateKey) ([]byte, error) {
+	return nil, errES256KDisabled
+}
+
+func secp256k1PrivateKeyFromScalar(elliptic.Curve, []byte) (*ecdsa.PrivateKey, error) {
+	return nil, errES256KDisabled
+}
@@ -0,0 +1,33 @@
+//go:build !jwx_es256k
+
+package token_test
+
+import (
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/murar8/local-jwks-server/internal/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestES256KDisabled(t *testing.T) {
+	t.Parallel()
+
+	t.Run("returns an error for the secp256k1 curve", func(t *testing.T) {
+		t.Parallel()
+
+		curve, err := token.AlgorithmToECDSACurve(jwa.ES256K)
+		assert.Nil(t, curve)
+		require.ErrorIs(t, err, token.ErrUnsupportedCurve)
+	})
+
+	t.Run("returns an error when generating a ES256K key", func(t *testing.T) {
+		t.Parallel()
+
+		key, err := token.GeneratePrivateKey(jwa.ES256K, 2048)
+		assert.Nil(t, key)
+		require.ErrorIs(t, err, token.ErrUnsupportedGenAlgorithm)
+		assert.EqualError(t, err, "unsupported algorithm for key generation: ES256K")
+	})
+}
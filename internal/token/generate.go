@@ -2,6 +2,7 @@ package token
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
 	"errors"
@@ -14,11 +15,36 @@ import (
 // for key generation.
 var ErrUnsupportedGenAlgorithm = errors.New("unsupported algorithm for key generation")
 
-// GeneratePrivateKey generates an RSA or ECDSA key based on the provided algorithm.
-func GeneratePrivateKey(alg jwa.SignatureAlgorithm, keySize int) (interface{}, error) {
+// GenerateOption customizes how private keys are generated.
+type GenerateOption func(*generateOptions)
+
+type generateOptions struct {
+	seed []byte
+}
+
+// WithSeed makes key generation deterministic, so that the same seed and
+// algorithm always produce the same key. An empty seed is ignored.
+func WithSeed(seed []byte) GenerateOption {
+	return func(o *generateOptions) {
+		o.seed = seed
+	}
+}
+
+// GeneratePrivateKey generates an RSA, ECDSA or Ed25519 key, or an HMAC
+// secret, based on the provided algorithm.
+func GeneratePrivateKey(alg jwa.SignatureAlgorithm, keySize int, opts ...GenerateOption) (interface{}, error) {
 	var key interface{}
 	var err error
 
+	var o generateOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if len(o.seed) > 0 {
+		return generateSeededKey(alg, keySize, newSeedReader(o.seed, alg))
+	}
+
 	switch alg {
 	case
 		jwa.RS256,
@@ -31,9 +57,24 @@ func GeneratePrivateKey(alg jwa.SignatureAlgorithm, keySize int) (interface{}, e
 	case
 		jwa.ES256,
 		jwa.ES384,
-		jwa.ES512:
-		curve, _ := AlgorithmToECDSACurve(alg)
-		key, err = ecdsa.GenerateKey(curve, rand.Reader)
+		jwa.ES512,
+		jwa.ES256K:
+		curve, curveErr := AlgorithmToECDSACurve(alg)
+		if curveErr != nil {
+			err = fmt.Errorf("%w: %s", ErrUnsupportedGenAlgorithm, alg)
+		} else {
+			key, err = ecdsa.GenerateKey(curve, rand.Reader)
+		}
+	case jwa.EdDSA:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	case
+		jwa.HS256,
+		jwa.HS384,
+		jwa.HS512:
+		size, _ := AlgorithmToHMACSecretSize(alg)
+		secret := make([]byte, size)
+		_, err = rand.Read(secret)
+		key = secret
 	default:
 		err = fmt.Errorf("%w: %s", ErrUnsupportedGenAlgorithm, alg)
 	}
@@ -2,12 +2,14 @@ package token_test
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rsa"
 	"fmt"
 	"testing"
 
 	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/murar8/local-jwks-server/internal/config"
 	"github.com/murar8/local-jwks-server/internal/token"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -58,12 +60,130 @@ func TestGenerateRawKey(t *testing.T) {
 		})
 	}
 
+	t.Run("generates a EdDSA key", func(t *testing.T) {
+		t.Parallel()
+
+		key, err := token.GeneratePrivateKey(jwa.EdDSA, 2048)
+		require.NoError(t, err)
+		assert.IsType(t, ed25519.PrivateKey{}, key)
+	})
+
+	hmacs := []struct {
+		alg  jwa.SignatureAlgorithm
+		size int
+	}{
+		{jwa.HS256, 32},
+		{jwa.HS384, 48},
+		{jwa.HS512, 64},
+	}
+
+	for _, tt := range hmacs {
+		t.Run(fmt.Sprintf("generates a %s secret", tt.alg), func(t *testing.T) {
+			t.Parallel()
+
+			key, err := token.GeneratePrivateKey(tt.alg, 2048)
+			require.NoError(t, err)
+			assert.IsType(t, []byte{}, key)
+			assert.Len(t, key, tt.size)
+		})
+	}
+
+	t.Run("returns an error for unsupported algorithms", func(t *testing.T) {
+		t.Parallel()
+
+		key, err := token.GeneratePrivateKey(jwa.NoSignature, 2048)
+		assert.Nil(t, key)
+		require.ErrorIs(t, err, token.ErrUnsupportedGenAlgorithm)
+		assert.EqualError(t, err, "unsupported algorithm for key generation: none")
+	})
+}
+
+func TestGenerateSeededKey(t *testing.T) {
+	t.Parallel()
+
+	// Seeded keys must stay stable across releases, since fixtures depend on
+	// them.
+	golden := []struct {
+		alg jwa.SignatureAlgorithm
+		kid string
+	}{
+		{jwa.RS256, "4aSlysggZi51Utr9HMau8H2zsGmoA2eqkxiNBXY6huw"},
+		{jwa.PS512, "vn2Owf3Xe7YquaJs2_9UTWqgVJWuMA3KDME94Fv1JwA"},
+		{jwa.ES256, "YjvMo4aNmoh_SvE5Z-Zak2J9l2c6yK77vWtAwXM7dTA"},
+		{jwa.ES384, "wI48aqW5e84do147yhEYmYKL3vBEFOpzgz9AwBhRAhg"},
+		{jwa.ES512, "LZR6HOj3ven3NacHRhokv2m1qFsxli5OPaRAiEk3ri0"},
+		{jwa.EdDSA, "Mb7oCiBWLZTFFaw7U3AP5Ra9ClwzvnWdyEMVlZ88d-w"},
+		{jwa.HS256, "7a9uR4-GZaBQdJGcdnkboFRp5xn8aFqFYhXu6NKaI6A"},
+	}
+
+	for _, tt := range golden {
+		alg := tt.alg
+		kid := tt.kid
+
+		t.Run(fmt.Sprintf("generates a deterministic %s key", alg), func(t *testing.T) {
+			t.Parallel()
+
+			raw, err := token.GeneratePrivateKey(alg, 2048, token.WithSeed([]byte("test")))
+			require.NoError(t, err)
+
+			key, err := token.NewKey(raw, &config.Key{Alg: alg})
+			require.NoError(t, err)
+			assert.Equal(t, kid, key.KeyID())
+		})
+	}
+
+	t.Run("generates valid RSA keys", func(t *testing.T) {
+		t.Parallel()
+
+		key, err := token.GeneratePrivateKey(jwa.RS256, 2048, token.WithSeed([]byte("test")))
+		require.NoError(t, err)
+		require.NoError(t, key.(*rsa.PrivateKey).Validate())
+		assert.Equal(t, 2048, key.(*rsa.PrivateKey).N.BitLen())
+	})
+
+	t.Run("generates ECDSA keys on the curve", func(t *testing.T) {
+		t.Parallel()
+
+		key, err := token.GeneratePrivateKey(jwa.ES512, 0, token.WithSeed([]byte("test")))
+		require.NoError(t, err)
+
+		ecdsaKey := key.(*ecdsa.PrivateKey)
+		assert.True(t, ecdsaKey.Curve.IsOnCurve(ecdsaKey.X, ecdsaKey.Y))
+	})
+
+	t.Run("generates different keys for different seeds", func(t *testing.T) {
+		t.Parallel()
+
+		a, err := token.GeneratePrivateKey(jwa.EdDSA, 0, token.WithSeed([]byte("a")))
+		require.NoError(t, err)
+		b, err := token.GeneratePrivateKey(jwa.EdDSA, 0, token.WithSeed([]byte("b")))
+		require.NoError(t, err)
+		assert.NotEqual(t, a, b)
+	})
+
+	t.Run("ignores an empty seed", func(t *testing.T) {
+		t.Parallel()
+
+		a, err := token.GeneratePrivateKey(jwa.EdDSA, 0, token.WithSeed(nil))
+		require.NoError(t, err)
+		b, err := token.GeneratePrivateKey(jwa.EdDSA, 0, token.WithSeed(nil))
+		require.NoError(t, err)
+		assert.NotEqual(t, a, b)
+	})
+
+	t.Run("returns an error for small RSA keys", func(t *testing.T) {
+		t.Parallel()
+
+		key, err := token.GeneratePrivateKey(jwa.RS256, 512, token.WithSeed([]byte("test")))
+		assert.Nil(t, key)
+		assert.EqualError(t, err, "failed to generate RSA key: 512-bit keys are insecure")
+	})
+
 	t.Run("returns an error for unsupported algorithms", func(t *testing.T) {
 		t.Parallel()
 
-		key, err := token.GeneratePrivateKey(jwa.HS256, 2048)
+		key, err := token.GeneratePrivateKey(jwa.NoSignature, 0, token.WithSeed([]byte("test")))
 		assert.Nil(t, key)
 		require.ErrorIs(t, err, token.ErrUnsupportedGenAlgorithm)
-		assert.EqualError(t, err, "unsupported algorithm for key generation: HS256")
 	})
 }
@@ -0,0 +1,49 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+)
+
+// ErrHeaderConflict is returned when the requested header does not match the
+// signing key.
+var ErrHeaderConflict = errors.New("header conflicts with the signing key")
+
+// headerKeySelection returns the key ID and algorithm requested by the header,
+// which select the signing key when no other selection is provided.
+func headerKeySelection(headers map[string]interface{}) (string, jwa.SignatureAlgorithm) {
+	kid, _ := headers[jws.KeyIDKey].(string)
+	alg, _ := headers[jws.AlgorithmKey].(string)
+
+	return kid, jwa.SignatureAlgorithm(alg)
+}
+
+// buildHeaders creates the protected header of a token signed with key. The
+// alg and kid fields are derived from the key and must match it if provided.
+func buildHeaders(key jwk.Key, headers map[string]interface{}) (jws.Headers, error) {
+	expected := map[string]string{
+		jws.AlgorithmKey: key.Algorithm().String(),
+		jws.KeyIDKey:     key.KeyID(),
+	}
+
+	res := jws.NewHeaders()
+
+	for k, v := range headers {
+		if want, exists := expected[k]; exists {
+			if got, _ := v.(string); got != want {
+				return nil, fmt.Errorf("%w: %s is %v but the key requires %q", ErrHeaderConflict, k, v, want)
+			}
+			continue
+		}
+
+		if err := res.Set(k, v); err != nil {
+			return nil, fmt.Errorf("failed to set header: %w", err)
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,39 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+)
+
+// ErrUnsupportedHMAC is returned when the algorithm is not an HMAC algorithm.
+var ErrUnsupportedHMAC = errors.New("could not convert algorithm to HMAC secret size")
+
+// AlgorithmToHMACSecretSize retrieves the minimum secret size in bytes for the
+// provided algorithm. RFC7518 requires the secret to be at least as long as
+// the hash output.
+func AlgorithmToHMACSecretSize(alg jwa.SignatureAlgorithm) (int, error) {
+	var size int
+	var err error
+
+	switch alg {
+	case jwa.HS256:
+		size = 32
+	case jwa.HS384:
+		size = 48
+	case jwa.HS512:
+		size = 64
+	default:
+		err = fmt.Errorf("%w: %s", ErrUnsupportedHMAC, alg)
+	}
+
+	return size, err
+}
+
+// IsSymmetric reports whether the key is a shared secret that must never be
+// published.
+func IsSymmetric(key jwk.Key) bool {
+	return key.KeyType() == jwa.OctetSeq
+}
@@ -0,0 +1,65 @@
+package token_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/murar8/local-jwks-server/internal/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlgorithmToHMACSecretSize(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		alg  jwa.SignatureAlgorithm
+		size int
+	}{
+		{jwa.HS256, 32},
+		{jwa.HS384, 48},
+		{jwa.HS512, 64},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("returns the secret size for %s algorithm", tt.alg), func(t *testing.T) {
+			t.Parallel()
+
+			res, err := token.AlgorithmToHMACSecretSize(tt.alg)
+			require.NoError(t, err)
+			assert.Equal(t, tt.size, res)
+		})
+	}
+
+	t.Run("returns an error for unsupported algorithm", func(t *testing.T) {
+		t.Parallel()
+
+		res, err := token.AlgorithmToHMACSecretSize("RS256")
+		assert.Zero(t, res)
+		require.ErrorIs(t, err, token.ErrUnsupportedHMAC)
+		assert.EqualError(t, err, "could not convert algorithm to HMAC secret size: RS256")
+	})
+}
+
+func TestIsSymmetric(t *testing.T) {
+	t.Parallel()
+
+	t.Run("returns true for shared secrets", func(t *testing.T) {
+		t.Parallel()
+
+		key, _ := jwk.FromRaw([]byte("secret"))
+		assert.True(t, token.IsSymmetric(key))
+	})
+
+	t.Run("returns false for asymmetric keys", func(t *testing.T) {
+		t.Parallel()
+
+		raw, _ := rsa.GenerateKey(rand.Reader, 2048)
+		key, _ := jwk.FromRaw(raw)
+		assert.False(t, token.IsSymmetric(key))
+	})
+}
@@ -1,14 +1,18 @@
 package token
 
 import (
+	"bytes"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/json"
 	"encoding/pem"
 	"errors"
 	"fmt"
 
 	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
 )
 
 var (
@@ -22,31 +26,271 @@ var (
 	// ErrUnsupportedParseAlgorithm is returned when the algorithm is not
 	// supported for key parsing.
 	ErrUnsupportedParseAlgorithm = errors.New("unsupported algorithm for key parsing")
+
+	// ErrSecretTooShort is returned when an HMAC secret is shorter than the
+	// hash output of the configured algorithm.
+	ErrSecretTooShort = errors.New("secret too short")
+
+	// ErrInvalidJWK is returned when the JWK or JWKS document is invalid.
+	ErrInvalidJWK = errors.New("invalid JWK")
 )
 
-// ParsePrivateKey parses a private key from PEM format.
-func ParsePrivateKey(data []byte, alg jwa.SignatureAlgorithm) (interface{}, error) {
+// ParseOption customizes how private keys are parsed.
+type ParseOption func(*parseOptions)
+
+type parseOptions struct {
+	passphrase []byte
+	inferAlg   bool
+}
+
+// WithPassphrase sets the passphrase used to decrypt encrypted PKCS#8 keys.
+func WithPassphrase(passphrase []byte) ParseOption {
+	return func(o *parseOptions) {
+		o.passphrase = passphrase
+	}
+}
+
+// WithInferredAlgorithm uses the default algorithm of the key type for keys
+// without an algorithm that do not match the configured one: RS256 for RSA
+// keys, ES256, ES384, ES512 or ES256K depending on the curve for ECDSA keys
+// and EdDSA for Ed25519 keys. PEM data is never used as an HMAC secret.
+func WithInferredAlgorithm() ParseOption {
+	return func(o *parseOptions) {
+		o.inferAlg = true
+	}
+}
+
+// ParsePrivateKey parses a single private key, see ParsePrivateKeys.
+func ParsePrivateKey(data []byte, alg jwa.SignatureAlgorithm, opts ...ParseOption) (interface{}, error) {
+	keys, err := ParsePrivateKeys(data, alg, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) != 1 {
+		return nil, fmt.Errorf("%w: expected a single key, found %d", ErrInvalidJWK, len(keys))
+	}
+
+	return keys[0], nil
+}
+
+// ParsePrivateKeys parses private keys from a JWK or JWKS document, or a
+// single private key from PEM format. For HMAC algorithms non JSON data is
+// used as the shared secret, ignoring trailing newlines.
+//
+// Keys parsed from JSON are returned as jwk.Key values so that their
+// metadata is preserved, and are validated against their own algorithm if
+// present.
+//
+// Encrypted PKCS#8 keys are decrypted using the passphrase provided with
+// WithPassphrase. Certificates found in PEM data are attached to the key, see
+// SetCertificateChain.
+func ParsePrivateKeys(data []byte, alg jwa.SignatureAlgorithm, opts ...ParseOption) ([]interface{}, error) {
 	var key interface{}
 	var err error
 
-	block, _ := pem.Decode(data)
+	var o parseOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if isJSON(data) {
+		return parseJWKs(data, alg, &o)
+	}
+
+	if _, err = AlgorithmToHMACSecretSize(alg); err == nil && !(o.inferAlg && isPEM(data)) {
+		if key, err = parseSecret(data, alg); err != nil {
+			return nil, err
+		}
+		return []interface{}{key}, nil
+	}
+
+	if key, err = parsePEM(data, alg, &o); err != nil {
+		return nil, err
+	}
+
+	return []interface{}{key}, nil
+}
+
+// parsePEM parses the first private key block of the PEM data. If the data
+// also contains certificates, or the algorithm is inferred, the key is returned
+// as a jwk.Key holding the certificate chain and the algorithm.
+func parsePEM(data []byte, alg jwa.SignatureAlgorithm, o *parseOptions) (interface{}, error) {
+	var key interface{}
+	var err error
+
+	block, rest := pem.Decode(data)
+	for block != nil && block.Type == certificatePEMType {
+		block, rest = pem.Decode(rest)
+	}
 	if block == nil {
 		return nil, ErrInvalidPEM
 	}
 
-	if key, err = x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
-		if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
-			if key, err = x509.ParseECPrivateKey(block.Bytes); err != nil {
-				return nil, fmt.Errorf("%w: %s", ErrInvalidPEM, "failed to parse private key")
+	if block.Type == encryptedPEMType {
+		key, err = parseEncryptedDER(block.Bytes, o.passphrase)
+	} else {
+		key, err = parseDER(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if o.inferAlg {
+		alg = inferAlgorithm(key, alg)
+	}
+
+	if err = validateKey(key, alg); err != nil {
+		return nil, err
+	}
+
+	chain, err := parseCertificates(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(chain) == 0 && !o.inferAlg {
+		return key, nil
+	}
+
+	jwkKey, err := jwk.FromRaw(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key: %w", err)
+	}
+
+	if o.inferAlg {
+		if err = jwkKey.Set(jwk.AlgorithmKey, alg); err != nil {
+			return nil, fmt.Errorf("failed to set key algorithm: %w", err)
+		}
+	}
+
+	if len(chain) > 0 {
+		if err = SetCertificateChain(jwkKey, chain); err != nil {
+			return nil, err
+		}
+	}
+
+	return jwkKey, nil
+}
+
+func isJSON(data []byte) bool {
+	trimmed := bytes.TrimSpace(data)
+	return len(trimmed) > 0 && trimmed[0] == '{' && json.Valid(trimmed)
+}
+
+func isPEM(data []byte) bool {
+	block, _ := pem.Decode(data)
+	return block != nil
+}
+
+func parseJWKs(data []byte, alg jwa.SignatureAlgorithm, o *parseOptions) ([]interface{}, error) {
+	set, err := jwk.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidJWK, err)
+	}
+
+	keys := make([]interface{}, 0, set.Len())
+
+	for i := range set.Len() {
+		key, _ := set.Key(i)
+
+		var raw interface{}
+		if err = key.Raw(&raw); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidJWK, err)
+		}
+
+		keyAlg := alg
+		switch {
+		case key.Algorithm().String() != "":
+			keyAlg = jwa.SignatureAlgorithm(key.Algorithm().String())
+		case o.inferAlg:
+			keyAlg = inferAlgorithm(raw, alg)
+			if err = key.Set(jwk.AlgorithmKey, keyAlg); err != nil {
+				return nil, fmt.Errorf("failed to set key algorithm: %w", err)
 			}
 		}
+
+		if err = validateKey(raw, keyAlg); err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
 	}
 
-	if err = validateKey(key, alg); err != nil {
+	return keys, nil
+}
+
+func parseDER(der []byte) (interface{}, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	if key, err := parseSecp256k1PrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrInvalidPEM, "failed to parse private key")
+}
+
+func parseEncryptedDER(der, passphrase []byte) (interface{}, error) {
+	if len(passphrase) == 0 {
+		return nil, ErrMissingPassphrase
+	}
+
+	decrypted, err := decryptPKCS8(der, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decrypting with the wrong passphrase can yield valid padding by chance,
+	// in which case the key itself is garbage.
+	key, err := parseDER(decrypted)
+	if err != nil {
+		return nil, ErrIncorrectPassphrase
+	}
+
+	return key, nil
+}
+
+func parseSecret(data []byte, alg jwa.SignatureAlgorithm) (interface{}, error) {
+	secret := bytes.Clone(bytes.TrimRight(data, "\r\n"))
+
+	if err := validateKey(secret, alg); err != nil {
 		return nil, err
 	}
 
-	return key, err
+	return secret, nil
+}
+
+// inferAlgorithm returns alg if the key can be used with it, or otherwise the
+// default algorithm of the key type. Unknown key types keep alg so that
+// validation reports the mismatch.
+func inferAlgorithm(key interface{}, alg jwa.SignatureAlgorithm) jwa.SignatureAlgorithm {
+	if validateKey(key, alg) == nil {
+		return alg
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return jwa.RS256
+	case ed25519.PrivateKey:
+		return jwa.EdDSA
+	case *ecdsa.PrivateKey:
+		for _, curveAlg := range []jwa.SignatureAlgorithm{jwa.ES256, jwa.ES384, jwa.ES512, jwa.ES256K} {
+			if curve, err := AlgorithmToECDSACurve(curveAlg); err == nil && k.Curve == curve {
+				return curveAlg
+			}
+		}
+	}
+
+	return alg
 }
 
 func validateKey(key interface{}, alg jwa.SignatureAlgorithm) error {
@@ -66,16 +310,36 @@ func validateKey(key interface{}, alg jwa.SignatureAlgorithm) error {
 	case
 		jwa.ES256,
 		jwa.ES384,
-		jwa.ES512:
+		jwa.ES512,
+		jwa.ES256K:
 		ecdsaKey, ok := key.(*ecdsa.PrivateKey)
 		if ok {
-			curve, _ := AlgorithmToECDSACurve(alg)
-			if ecdsaKey.Curve != curve {
+			curve, curveErr := AlgorithmToECDSACurve(alg)
+			if curveErr != nil {
+				err = fmt.Errorf("%w: %s", ErrUnsupportedParseAlgorithm, alg)
+			} else if ecdsaKey.Curve != curve {
 				err = fmt.Errorf("%w: expected %s curve", ErrWrongKeyType, alg)
 			}
 		} else {
 			err = fmt.Errorf("%w: expected ECDSA private key", ErrWrongKeyType)
 		}
+	case jwa.EdDSA:
+		if _, ok := key.(ed25519.PrivateKey); !ok {
+			err = fmt.Errorf("%w: expected Ed25519 private key", ErrWrongKeyType)
+		}
+	case
+		jwa.HS256,
+		jwa.HS384,
+		jwa.HS512:
+		secret, ok := key.([]byte)
+		if ok {
+			size, _ := AlgorithmToHMACSecretSize(alg)
+			if len(secret) < size {
+				err = fmt.Errorf("%w: %s requires at least %d bytes", ErrSecretTooShort, alg, size)
+			}
+		} else {
+			err = fmt.Errorf("%w: expected HMAC secret", ErrWrongKeyType)
+		}
 	default:
 		err = fmt.Errorf("%w: %s", ErrUnsupportedParseAlgorithm, alg)
 	}
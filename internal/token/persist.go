@@ -0,0 +1,87 @@
+package token
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+)
+
+// MarshalPrivateKey encodes a private key in PKCS#8 PEM format. HMAC secrets
+// have no PEM representation and are encoded as a JWK instead.
+func MarshalPrivateKey(key interface{}) ([]byte, error) {
+	if secret, ok := key.([]byte); ok {
+		return marshalSecret(secret)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if ecdsaKey, ok := key.(*ecdsa.PrivateKey); ok && err != nil {
+		der, err = marshalSecp256k1PrivateKey(ecdsaKey)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal private key: %w", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// SavePrivateKey writes a private key to path, see MarshalPrivateKey. The key
+// is written to a temporary file readable only by the owner, which is then
+// renamed so that a partially written key is never observed.
+func SavePrivateKey(path string, key interface{}) error {
+	data, err := MarshalPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	if err = os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create key directory: %w", err)
+	}
+
+	// CreateTemp creates the file with 0600 permissions.
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary key file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to rename key file: %w", err)
+	}
+
+	return nil
+}
+
+func marshalSecret(secret []byte) ([]byte, error) {
+	key, err := jwk.FromRaw(secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal secret: %w", err)
+	}
+
+	data, err := json.Marshal(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal secret: %w", err)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,217 @@
+package token
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"math/big"
+	mrand "math/rand/v2"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+)
+
+// rsaPublicExponent is the public exponent used for generated RSA keys.
+const rsaPublicExponent = 65537
+
+// minRSAKeySize is the smallest RSA key size accepted by the standard library.
+const minRSAKeySize = 1024
+
+// primeRounds is the number of Miller-Rabin rounds used when testing
+// generated RSA primes.
+const primeRounds = 20
+
+// newSeedReader returns a deterministic stream of bytes derived from the seed
+// and the algorithm, so that keys generated for different algorithms from the
+// same seed are unrelated.
+func newSeedReader(seed []byte, alg jwa.SignatureAlgorithm) io.Reader {
+	h := sha256.New()
+	h.Write(seed)
+	h.Write([]byte{0})
+	h.Write([]byte(alg.String()))
+
+	var key [32]byte
+	copy(key[:], h.Sum(nil))
+
+	// The standard library key generators ignore custom readers, so the keys
+	// are derived from a seeded ChaCha8 stream instead.
+	return mrand.NewChaCha8(key) //nolint:gosec // Seeded keys are deterministic by design.
+}
+
+// generateSeededKey generates a key for the provided algorithm using only
+// bytes read from r.
+func generateSeededKey(alg jwa.SignatureAlgorithm, keySize int, r io.Reader) (interface{}, error) {
+	var key interface{}
+	var err error
+
+	switch alg {
+	case
+		jwa.RS256,
+		jwa.RS384,
+		jwa.RS512,
+		jwa.PS256,
+		jwa.PS384,
+		jwa.PS512:
+		key, err = seededRSAKey(r, keySize)
+	case
+		jwa.ES256,
+		jwa.ES384,
+		jwa.ES512,
+		jwa.ES256K:
+		curve, curveErr := AlgorithmToECDSACurve(alg)
+		if curveErr != nil {
+			err = fmt.Errorf("%w: %s", ErrUnsupportedGenAlgorithm, alg)
+		} else {
+			key, err = seededECDSAKey(r, curve)
+		}
+	case jwa.EdDSA:
+		seed := make([]byte, ed25519.SeedSize)
+		if _, err = io.ReadFull(r, seed); err == nil {
+			key = ed25519.NewKeyFromSeed(seed)
+		}
+	case
+		jwa.HS256,
+		jwa.HS384,
+		jwa.HS512:
+		size, _ := AlgorithmToHMACSecretSize(alg)
+		secret := make([]byte, size)
+		_, err = io.ReadFull(r, secret)
+		key = secret
+	default:
+		err = fmt.Errorf("%w: %s", ErrUnsupportedGenAlgorithm, alg)
+	}
+
+	return key, err
+}
+
+func seededRSAKey(r io.Reader, bits int) (*rsa.PrivateKey, error) {
+	if bits < minRSAKeySize {
+		return nil, fmt.Errorf("failed to generate RSA key: %d-bit keys are insecure", bits)
+	}
+
+	e := big.NewInt(rsaPublicExponent)
+	one := big.NewInt(1)
+
+	for {
+		p, err := seededPrime(r, bits-bits/2)
+		if err != nil {
+			return nil, err
+		}
+
+		q, err := seededPrime(r, bits/2)
+		if err != nil {
+			return nil, err
+		}
+
+		if p.Cmp(q) == 0 {
+			continue
+		}
+
+		pMinus1 := new(big.Int).Sub(p, one)
+		qMinus1 := new(big.Int).Sub(q, one)
+
+		// The private exponent is computed modulo λ(N) = lcm(p-1, q-1).
+		lambda := new(big.Int).Mul(pMinus1, qMinus1)
+		lambda.Div(lambda, new(big.Int).GCD(nil, nil, pMinus1, qMinus1))
+
+		d := new(big.Int).ModInverse(e, lambda)
+		if d == nil {
+			continue
+		}
+
+		key := &rsa.PrivateKey{
+			PublicKey: rsa.PublicKey{N: new(big.Int).Mul(p, q), E: rsaPublicExponent},
+			D:         d,
+			Primes:    []*big.Int{p, q},
+		}
+		key.Precompute()
+
+		if err = key.Validate(); err != nil {
+			return nil, fmt.Errorf("failed to generate RSA key: %w", err)
+		}
+
+		return key, nil
+	}
+}
+
+func seededPrime(r io.Reader, bits int) (*big.Int, error) {
+	buf := make([]byte, (bits+7)/8)
+	p := new(big.Int)
+
+	for {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, fmt.Errorf("failed to read seed: %w", err)
+		}
+
+		// Setting the two most significant bits guarantees that the product
+		// of two primes has exactly twice as many bits.
+		buf[0] &= 0xff >> (8*len(buf) - bits)
+		p.SetBytes(buf)
+		p.SetBit(p, bits-1, 1)
+		p.SetBit(p, bits-2, 1)
+		p.SetBit(p, 0, 1)
+
+		if p.ProbablyPrime(primeRounds) {
+			return p, nil
+		}
+	}
+}
+
+func seededECDSAKey(r io.Reader, curve elliptic.Curve) (*ecdsa.PrivateKey, error) {
+	n := curve.Params().N
+	buf := make([]byte, (n.BitLen()+7)/8)
+	d := new(big.Int)
+
+	for {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, fmt.Errorf("failed to read seed: %w", err)
+		}
+
+		buf[0] &= 0xff >> (8*len(buf) - n.BitLen())
+		d.SetBytes(buf)
+
+		// Rejection sampling keeps the scalar uniformly distributed in [1, N).
+		if d.Sign() != 0 && d.Cmp(n) < 0 {
+			return ecdsaKeyFromScalar(curve, buf)
+		}
+	}
+}
+
+// ecdsaKeyFromScalar builds an ECDSA key from a big endian scalar of the
+// curve order length.
+func ecdsaKeyFromScalar(curve elliptic.Curve, scalar []byte) (*ecdsa.PrivateKey, error) {
+	var ecdhCurve ecdh.Curve
+
+	switch curve {
+	case elliptic.P256():
+		ecdhCurve = ecdh.P256()
+	case elliptic.P384():
+		ecdhCurve = ecdh.P384()
+	case elliptic.P521():
+		ecdhCurve = ecdh.P521()
+	default:
+		return secp256k1PrivateKeyFromScalar(curve, scalar)
+	}
+
+	priv, err := ecdhCurve.NewPrivateKey(scalar)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ECDSA key: %w", err)
+	}
+
+	// The public key is encoded as 0x04 || X || Y.
+	pub := priv.PublicKey().Bytes()
+	size := (len(pub) - 1) / 2
+
+	return &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(pub[1 : 1+size]),
+			Y:     new(big.Int).SetBytes(pub[1+size:]),
+		},
+		D: new(big.Int).SetBytes(scalar),
+	}, nil
+}
@@ -1,28 +1,108 @@
 package token
 
 import (
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
+	"github.com/lestrrat-go/jwx/v2/jwa"
 	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
 	"github.com/lestrrat-go/jwx/v2/jwt"
 	"github.com/murar8/local-jwks-server/internal/config"
 )
 
+var (
+	// ErrNoKeys is returned when a service is created without any key.
+	ErrNoKeys = errors.New("no keys provided")
+
+	// ErrDuplicateKeyID is returned when two keys share the same key ID.
+	ErrDuplicateKeyID = errors.New("duplicate key ID")
+
+	// ErrKeyNotFound is returned when no key matches the requested key ID or
+	// algorithm.
+	ErrKeyNotFound = errors.New("key not found")
+
+	// ErrDefaultKey is returned when trying to remove the default key.
+	ErrDefaultKey = errors.New("cannot remove the default key")
+)
+
 type Service interface {
 	GetKey() jwk.Key
+	GetKeys() []jwk.Key
 	GetKeySet() (jwk.Set, error)
-	SignToken(payload map[string]interface{}) ([]byte, error)
+	FindKey(kid string, alg jwa.SignatureAlgorithm) (jwk.Key, error)
+	SignToken(payload map[string]interface{}, opts ...SignOption) ([]byte, error)
+	VerifyToken(signed []byte, opts ...VerifyOption) *Verification
+	AddKey(key jwk.Key) error
+	ReplaceKey(key jwk.Key) error
+	RemoveKey(kid string) error
+	SetDefaultKey(kid string) error
+}
+
+// SignOption customizes how SignToken selects the signing key and builds the
+// token.
+type SignOption func(*signOptions)
+
+type signOptions struct {
+	kid     string
+	alg     jwa.SignatureAlgorithm
+	ttl     *time.Duration
+	headers map[string]interface{}
+}
+
+// WithKeyID selects the signing key by key ID.
+func WithKeyID(kid string) SignOption {
+	return func(o *signOptions) {
+		o.kid = kid
+	}
+}
+
+// WithAlgorithm selects the signing key by algorithm.
+func WithAlgorithm(alg jwa.SignatureAlgorithm) SignOption {
+	return func(o *signOptions) {
+		o.alg = alg
+	}
+}
+
+// WithTTL overrides the configured token lifetime. A zero TTL disables the
+// expiration time.
+func WithTTL(ttl time.Duration) SignOption {
+	return func(o *signOptions) {
+		o.ttl = &ttl
+	}
+}
+
+// WithHeaders adds fields to the protected header of the token. The kid and
+// alg fields must match the signing key, and select it when no other option
+// does.
+func WithHeaders(headers map[string]interface{}) SignOption {
+	return func(o *signOptions) {
+		o.headers = headers
+	}
 }
 
 type service struct {
-	key             jwk.Key
+	mu              sync.RWMutex
+	keys            []jwk.Key
+	defaultKey      jwk.Key
 	flattenAudience bool
+	claims          config.Claims
 }
 
-func FromRawKey(raw interface{}, cfg *config.JWK) (Service, error) {
-	key, err := jwk.FromRaw(raw)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse key: %w", err)
+// NewKey wraps a raw private key into a signing JWK. If raw is already a JWK
+// its existing fields are preserved and only the missing ones are filled in
+// from the configuration. A thumbprint based key ID is assigned when neither
+// provides one.
+func NewKey(raw interface{}, cfg *config.Key) (jwk.Key, error) {
+	var err error
+
+	key, ok := raw.(jwk.Key)
+	if !ok {
+		if key, err = jwk.FromRaw(raw); err != nil {
+			return nil, fmt.Errorf("failed to parse key: %w", err)
+		}
 	}
 
 	fields := []struct {
@@ -35,52 +115,277 @@ func FromRawKey(raw interface{}, cfg *config.JWK) (Service, error) {
 	}
 
 	for _, f := range fields {
+		if _, exists := key.Get(f.key); exists {
+			continue
+		}
 		if err = key.Set(f.key, f.val); err != nil {
 			return nil, fmt.Errorf("failed to set key field: %w", err)
 		}
 	}
 
-	if err = jwk.AssignKeyID(key); err != nil {
+	switch {
+	case key.KeyID() != "":
+	case cfg.KeyID != "":
+		err = key.Set(jwk.KeyIDKey, cfg.KeyID)
+	default:
+		err = jwk.AssignKeyID(key)
+	}
+	if err != nil {
 		return nil, fmt.Errorf("failed to assign key ID: %w", err)
 	}
 
-	return &service{
-		key:             key,
+	return key, nil
+}
+
+// NewKeys wraps the raw private keys loaded from a single source, see NewKey.
+// The configured key ID is only used when the source yields exactly one key,
+// the other keys without an ID fall back to their thumbprint.
+func NewKeys(raws []interface{}, cfg *config.Key) ([]jwk.Key, error) {
+	keyCfg := *cfg
+	if len(raws) > 1 {
+		keyCfg.KeyID = ""
+	}
+
+	keys := make([]jwk.Key, 0, len(raws))
+	for _, raw := range raws {
+		key, err := NewKey(raw, &keyCfg)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// New creates a token service serving the provided keys. Tokens are signed
+// with the key matching cfg.DefaultKeyID, or the first key if it is not set.
+func New(keys []jwk.Key, cfg *config.JWK) (Service, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if seen[key.KeyID()] {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateKeyID, key.KeyID())
+		}
+		seen[key.KeyID()] = true
+	}
+
+	s := &service{
+		keys:            append([]jwk.Key(nil), keys...),
+		defaultKey:      keys[0],
 		flattenAudience: cfg.FlattenAudience,
-	}, nil
+		claims:          cfg.Claims,
+	}
+
+	if cfg.DefaultKeyID != "" {
+		if err := s.SetDefaultKey(cfg.DefaultKeyID); err != nil {
+			return nil, fmt.Errorf("failed to find default key: %w", err)
+		}
+	}
+
+	return s, nil
+}
+
+// FromRawKey creates a token service serving a single key built from the
+// primary key configuration.
+func FromRawKey(raw interface{}, cfg *config.JWK) (Service, error) {
+	primary := cfg.PrimaryKey()
+
+	key, err := NewKey(raw, &primary)
+	if err != nil {
+		return nil, err
+	}
+
+	return New([]jwk.Key{key}, cfg)
 }
 
 func (s *service) GetKey() jwk.Key {
-	return s.key
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.defaultKey
+}
+
+func (s *service) GetKeys() []jwk.Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]jwk.Key(nil), s.keys...)
 }
 
 func (s *service) GetKeySet() (jwk.Set, error) {
-	pk, err := s.key.PublicKey()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get public key: %w", err)
-	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
 	set := jwk.NewSet()
-	_ = set.AddKey(pk)
+
+	for _, key := range s.keys {
+		// Shared secrets must never be published.
+		if IsSymmetric(key) {
+			continue
+		}
+
+		pk, err := key.PublicKey()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get public key: %w", err)
+		}
+		_ = set.AddKey(pk)
+	}
 
 	return set, nil
 }
 
-func (s *service) SignToken(payload map[string]interface{}) ([]byte, error) {
+// FindKey looks up a key by key ID and/or algorithm. When both are empty the
+// default key is returned. When only the algorithm is provided the default
+// key is preferred if it uses that algorithm.
+func (s *service) FindKey(kid string, alg jwa.SignatureAlgorithm) (jwk.Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.findKey(kid, alg)
+}
+
+func (s *service) findKey(kid string, alg jwa.SignatureAlgorithm) (jwk.Key, error) {
+	if kid == "" && alg == "" {
+		return s.defaultKey, nil
+	}
+
+	if kid == "" && s.defaultKey.Algorithm().String() == alg.String() {
+		return s.defaultKey, nil
+	}
+
+	for _, key := range s.keys {
+		if kid != "" && key.KeyID() != kid {
+			continue
+		}
+		if alg != "" && key.Algorithm().String() != alg.String() {
+			continue
+		}
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("%w: kid=%q alg=%q", ErrKeyNotFound, kid, alg)
+}
+
+// AddKey publishes a new key. The key can be selected for signing by key ID
+// or algorithm, but does not replace the default key.
+func (s *service) AddKey(key jwk.Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.findKey(key.KeyID(), ""); err == nil {
+		return fmt.Errorf("%w: %s", ErrDuplicateKeyID, key.KeyID())
+	}
+
+	s.keys = append(s.keys, key)
+
+	return nil
+}
+
+// ReplaceKey replaces the key with the same key ID, keeping its position in
+// the key set. If the replaced key is the default key the new key becomes the
+// default key.
+func (s *service) ReplaceKey(key jwk.Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, k := range s.keys {
+		if k.KeyID() != key.KeyID() {
+			continue
+		}
+
+		s.keys[i] = key
+		if s.defaultKey.KeyID() == key.KeyID() {
+			s.defaultKey = key
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("%w: kid=%q", ErrKeyNotFound, key.KeyID())
+}
+
+// RemoveKey removes a key from the key set. The default key cannot be
+// removed.
+func (s *service) RemoveKey(kid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.defaultKey.KeyID() == kid {
+		return fmt.Errorf("%w: %s", ErrDefaultKey, kid)
+	}
+
+	for i, key := range s.keys {
+		if key.KeyID() == kid {
+			s.keys = append(s.keys[:i:i], s.keys[i+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: kid=%q", ErrKeyNotFound, kid)
+}
+
+// SetDefaultKey changes the key used to sign tokens by default.
+func (s *service) SetDefaultKey(kid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, err := s.findKey(kid, "")
+	if err != nil {
+		return err
+	}
+
+	s.defaultKey = key
+
+	return nil
+}
+
+func (s *service) SignToken(payload map[string]interface{}, opts ...SignOption) ([]byte, error) {
+	var o signOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.kid == "" && o.alg == "" {
+		o.kid, o.alg = headerKeySelection(o.headers)
+	}
+
+	key, err := s.FindKey(o.kid, o.alg)
+	if err != nil {
+		return nil, err
+	}
+
 	t := jwt.New()
 
 	for k, v := range payload {
-		err := t.Set(k, v)
+		err = t.Set(k, v)
 		if err != nil {
 			return nil, fmt.Errorf("failed to set payload: %w", err)
 		}
 	}
 
+	claims := s.claims
+	if o.ttl != nil {
+		claims.TTL = *o.ttl
+	}
+
+	if err = setDefaultClaims(t, &claims); err != nil {
+		return nil, err
+	}
+
 	if s.flattenAudience {
 		t.Options().Enable(jwt.FlattenAudience)
 	}
 
-	jwt, err := jwt.Sign(t, jwt.WithKey(s.key.Algorithm(), s.key))
+	headers, err := buildHeaders(key, o.headers)
+	if err != nil {
+		return nil, err
+	}
+
+	jwt, err := jwt.Sign(t, jwt.WithKey(key.Algorithm(), key, jws.WithProtectedHeaders(headers)))
 	if err != nil {
 		return nil, fmt.Errorf("failed to sign token: %w", err)
 	}
@@ -7,11 +7,13 @@ import (
 	"encoding/json"
 	"strings"
 	"testing"
+	"time"
 
 	"encoding/base64"
 
 	"github.com/lestrrat-go/jwx/v2/jwa"
 	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
 	"github.com/lestrrat-go/jwx/v2/jwt"
 	"github.com/murar8/local-jwks-server/internal/config"
 	"github.com/murar8/local-jwks-server/internal/token"
@@ -42,6 +44,201 @@ func TestFromRawKey(t *testing.T) {
 	})
 }
 
+func makeKey(t *testing.T, alg jwa.SignatureAlgorithm, kid string) jwk.Key {
+	t.Helper()
+
+	raw, err := token.GeneratePrivateKey(alg, 2048)
+	require.NoError(t, err)
+
+	key, err := token.NewKey(raw, &config.Key{Alg: alg, KeyID: kid})
+	require.NoError(t, err)
+
+	return key
+}
+
+func TestNewKey(t *testing.T) {
+	t.Parallel()
+
+	t.Run("uses the configured key ID", func(t *testing.T) {
+		t.Parallel()
+
+		key := makeKey(t, jwa.ES256, "my-key")
+
+		assert.Equal(t, "my-key", key.KeyID())
+		assert.Equal(t, jwa.ES256, key.Algorithm())
+		assert.Equal(t, "sig", key.KeyUsage())
+	})
+
+	t.Run("preserves the fields of an existing JWK", func(t *testing.T) {
+		t.Parallel()
+
+		raw, _ := token.GeneratePrivateKey(jwa.ES256, 0)
+		existing, _ := jwk.FromRaw(raw)
+		_ = existing.Set(jwk.KeyIDKey, "existing")
+		_ = existing.Set(jwk.KeyUsageKey, "enc")
+		_ = existing.Set(jwk.KeyOpsKey, jwk.KeyOperationList{"sign"})
+
+		cfg := &config.Key{Alg: jwa.ES256, KeyID: "configured", KeyOps: jwk.KeyOperationList{"verify"}}
+		key, err := token.NewKey(existing, cfg)
+
+		require.NoError(t, err)
+		assert.Equal(t, "existing", key.KeyID())
+		assert.Equal(t, "enc", key.KeyUsage())
+		assert.Equal(t, jwk.KeyOperationList{"sign"}, key.KeyOps())
+		assert.Equal(t, jwa.ES256, key.Algorithm())
+	})
+
+	t.Run("assigns a thumbprint key ID if not configured", func(t *testing.T) {
+		t.Parallel()
+
+		key := makeKey(t, jwa.ES256, "")
+
+		assert.NotEmpty(t, key.KeyID())
+	})
+}
+
+func TestNewKeys(t *testing.T) {
+	t.Parallel()
+
+	t.Run("uses the configured key ID for a single key", func(t *testing.T) {
+		t.Parallel()
+
+		raw, _ := token.GeneratePrivateKey(jwa.ES256, 0)
+		keys, err := token.NewKeys([]interface{}{raw}, &config.Key{Alg: jwa.ES256, KeyID: "my-key"})
+
+		require.NoError(t, err)
+		require.Len(t, keys, 1)
+		assert.Equal(t, "my-key", keys[0].KeyID())
+	})
+
+	t.Run("ignores the configured key ID for several keys", func(t *testing.T) {
+		t.Parallel()
+
+		first, _ := token.GeneratePrivateKey(jwa.ES256, 0)
+		second, _ := token.GeneratePrivateKey(jwa.ES256, 0)
+		named, _ := jwk.FromRaw(first)
+		_ = named.Set(jwk.KeyIDKey, "named")
+
+		keys, err := token.NewKeys([]interface{}{named, second}, &config.Key{Alg: jwa.ES256, KeyID: "my-key"})
+
+		require.NoError(t, err)
+		require.Len(t, keys, 2)
+		assert.Equal(t, "named", keys[0].KeyID())
+		assert.NotEmpty(t, keys[1].KeyID())
+		assert.NotEqual(t, "my-key", keys[1].KeyID())
+
+		_, err = token.New(keys, &config.JWK{})
+		require.NoError(t, err)
+	})
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	t.Run("uses the first key as default", func(t *testing.T) {
+		t.Parallel()
+
+		keys := []jwk.Key{makeKey(t, jwa.RS256, "rsa"), makeKey(t, jwa.ES256, "ec")}
+		ts, err := token.New(keys, &config.JWK{})
+
+		require.NoError(t, err)
+		assert.Equal(t, "rsa", ts.GetKey().KeyID())
+		assert.Len(t, ts.GetKeys(), 2)
+	})
+
+	t.Run("uses the configured default key", func(t *testing.T) {
+		t.Parallel()
+
+		keys := []jwk.Key{makeKey(t, jwa.RS256, "rsa"), makeKey(t, jwa.ES256, "ec")}
+		ts, err := token.New(keys, &config.JWK{DefaultKeyID: "ec"})
+
+		require.NoError(t, err)
+		assert.Equal(t, "ec", ts.GetKey().KeyID())
+	})
+
+	t.Run("returns an error if the default key does not exist", func(t *testing.T) {
+		t.Parallel()
+
+		keys := []jwk.Key{makeKey(t, jwa.RS256, "rsa")}
+		ts, err := token.New(keys, &config.JWK{DefaultKeyID: "missing"})
+
+		assert.Nil(t, ts)
+		require.ErrorIs(t, err, token.ErrKeyNotFound)
+	})
+
+	t.Run("returns an error if key IDs are duplicated", func(t *testing.T) {
+		t.Parallel()
+
+		keys := []jwk.Key{makeKey(t, jwa.RS256, "dup"), makeKey(t, jwa.ES256, "dup")}
+		ts, err := token.New(keys, &config.JWK{})
+
+		assert.Nil(t, ts)
+		require.ErrorIs(t, err, token.ErrDuplicateKeyID)
+		assert.EqualError(t, err, "duplicate key ID: dup")
+	})
+
+	t.Run("returns an error if no keys are provided", func(t *testing.T) {
+		t.Parallel()
+
+		ts, err := token.New(nil, &config.JWK{})
+
+		assert.Nil(t, ts)
+		require.ErrorIs(t, err, token.ErrNoKeys)
+	})
+}
+
+func TestFindKey(t *testing.T) {
+	t.Parallel()
+
+	keys := []jwk.Key{
+		makeKey(t, jwa.RS256, "rsa-1"),
+		makeKey(t, jwa.ES256, "ec"),
+		makeKey(t, jwa.RS256, "rsa-2"),
+	}
+	ts, err := token.New(keys, &config.JWK{DefaultKeyID: "rsa-2"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		kid  string
+		alg  jwa.SignatureAlgorithm
+		want string
+	}{
+		{"returns the default key", "", "", "rsa-2"},
+		{"finds a key by ID", "rsa-1", "", "rsa-1"},
+		{"finds a key by algorithm", "", jwa.ES256, "ec"},
+		{"prefers the default key for its algorithm", "", jwa.RS256, "rsa-2"},
+		{"finds a key by ID and algorithm", "ec", jwa.ES256, "ec"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			key, err := ts.FindKey(tt.kid, tt.alg)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, key.KeyID())
+		})
+	}
+
+	t.Run("returns an error if the key ID and algorithm do not match", func(t *testing.T) {
+		t.Parallel()
+
+		key, err := ts.FindKey("ec", jwa.RS256)
+		assert.Nil(t, key)
+		require.ErrorIs(t, err, token.ErrKeyNotFound)
+		assert.EqualError(t, err, `key not found: kid="ec" alg="RS256"`)
+	})
+
+	t.Run("returns an error if no key uses the algorithm", func(t *testing.T) {
+		t.Parallel()
+
+		key, err := ts.FindKey("", jwa.PS256)
+		assert.Nil(t, key)
+		require.ErrorIs(t, err, token.ErrKeyNotFound)
+	})
+}
+
 func TestGetKey(t *testing.T) {
 	t.Parallel()
 
@@ -90,6 +287,56 @@ func TestGetKeySet(t *testing.T) {
 		assert.Nil(t, km["dq"])
 		assert.Nil(t, km["qi"])
 	})
+
+	t.Run("publishes EdDSA keys as OKP keys", func(t *testing.T) {
+		t.Parallel()
+
+		ts, _ := token.New([]jwk.Key{makeKey(t, jwa.EdDSA, "ed")}, &config.JWK{})
+		set, err := ts.GetKeySet()
+		require.NoError(t, err)
+
+		key, _ := set.Key(0)
+		km, _ := key.AsMap(context.Background())
+
+		assert.Equal(t, jwa.OKP, key.KeyType())
+		assert.Equal(t, jwa.EdDSA, key.Algorithm())
+		assert.Equal(t, jwa.Ed25519, km["crv"])
+		assert.NotNil(t, km["x"])
+		assert.Nil(t, km["d"])
+	})
+
+	t.Run("does not publish HMAC secrets", func(t *testing.T) {
+		t.Parallel()
+
+		keys := []jwk.Key{makeKey(t, jwa.HS256, "hmac"), makeKey(t, jwa.ES256, "ec")}
+		ts, _ := token.New(keys, &config.JWK{})
+		set, err := ts.GetKeySet()
+
+		require.NoError(t, err)
+		assert.Equal(t, 1, set.Len())
+
+		_, ok := set.LookupKeyID("hmac")
+		assert.False(t, ok)
+	})
+
+	t.Run("returns the public part of every key", func(t *testing.T) {
+		t.Parallel()
+
+		keys := []jwk.Key{makeKey(t, jwa.RS256, "rsa"), makeKey(t, jwa.ES256, "ec")}
+		ts, _ := token.New(keys, &config.JWK{})
+		set, err := ts.GetKeySet()
+
+		require.NoError(t, err)
+		assert.Equal(t, 2, set.Len())
+
+		for _, kid := range []string{"rsa", "ec"} {
+			key, ok := set.LookupKeyID(kid)
+			require.True(t, ok)
+
+			km, _ := key.AsMap(context.Background())
+			assert.Nil(t, km["d"])
+		}
+	})
 }
 
 func TestSignToken(t *testing.T) {
@@ -110,6 +357,65 @@ func TestSignToken(t *testing.T) {
 		assert.Equal(t, payload["name"], decoded.PrivateClaims()["name"])
 	})
 
+	t.Run("signs with the selected key", func(t *testing.T) {
+		t.Parallel()
+
+		keys := []jwk.Key{makeKey(t, jwa.RS256, "rsa"), makeKey(t, jwa.ES256, "ec")}
+		ts, _ := token.New(keys, &config.JWK{})
+		set, _ := ts.GetKeySet()
+
+		for _, opt := range []token.SignOption{token.WithKeyID("ec"), token.WithAlgorithm(jwa.ES256)} {
+			signed, err := ts.SignToken(map[string]interface{}{"sub": "john-doe"}, opt)
+			require.NoError(t, err)
+
+			msg, err := jws.Parse(signed)
+			require.NoError(t, err)
+			assert.Equal(t, "ec", msg.Signatures()[0].ProtectedHeaders().KeyID())
+
+			_, err = jwt.Parse(signed, jwt.WithKeySet(set))
+			require.NoError(t, err)
+		}
+	})
+
+	t.Run("signs with an EdDSA key", func(t *testing.T) {
+		t.Parallel()
+
+		ts, _ := token.New([]jwk.Key{makeKey(t, jwa.EdDSA, "ed")}, &config.JWK{})
+		set, _ := ts.GetKeySet()
+
+		signed, err := ts.SignToken(map[string]interface{}{"sub": "john-doe"})
+		require.NoError(t, err)
+
+		parsed, err := jwt.Parse(signed, jwt.WithKeySet(set))
+		require.NoError(t, err)
+		assert.Equal(t, "john-doe", parsed.Subject())
+	})
+
+	t.Run("signs with an HMAC secret", func(t *testing.T) {
+		t.Parallel()
+
+		raw, _ := token.GeneratePrivateKey(jwa.HS512, 0)
+		key, _ := token.NewKey(raw, &config.Key{Alg: jwa.HS512})
+		ts, _ := token.New([]jwk.Key{key}, &config.JWK{})
+
+		signed, err := ts.SignToken(map[string]interface{}{"sub": "john-doe"})
+		require.NoError(t, err)
+
+		parsed, err := jwt.Parse(signed, jwt.WithKey(jwa.HS512, raw))
+		require.NoError(t, err)
+		assert.Equal(t, "john-doe", parsed.Subject())
+	})
+
+	t.Run("returns an error if the selected key does not exist", func(t *testing.T) {
+		t.Parallel()
+
+		ts, _ := token.New([]jwk.Key{makeKey(t, jwa.RS256, "rsa")}, &config.JWK{})
+		signed, err := ts.SignToken(map[string]interface{}{}, token.WithKeyID("missing"))
+
+		assert.Nil(t, signed)
+		require.ErrorIs(t, err, token.ErrKeyNotFound)
+	})
+
 	t.Run("flattens audience when enabled", func(t *testing.T) {
 		t.Parallel()
 
@@ -159,6 +465,143 @@ func TestSignToken(t *testing.T) {
 		assert.True(t, isString, "audience should be flattened to a string")
 	})
 
+	t.Run("adds the default claims", func(t *testing.T) {
+		t.Parallel()
+
+		claims := config.Claims{
+			Issuer:        "https://issuer.example.com",
+			Audience:      []string{"api"},
+			TTL:           time.Hour,
+			NotBeforeSkew: time.Minute,
+			JTI:           true,
+		}
+		ts, _ := token.New([]jwk.Key{makeKey(t, jwa.ES256, "ec")}, &config.JWK{Claims: claims})
+
+		before := time.Now().Truncate(time.Second)
+		signed, err := ts.SignToken(map[string]interface{}{"sub": "john-doe"})
+		require.NoError(t, err)
+
+		parsed, err := jwt.Parse(signed, jwt.WithVerify(false))
+		require.NoError(t, err)
+		assert.WithinRange(t, parsed.IssuedAt(), before, time.Now())
+		assert.Equal(t, parsed.IssuedAt().Add(-time.Minute), parsed.NotBefore())
+		assert.Equal(t, parsed.IssuedAt().Add(time.Hour), parsed.Expiration())
+		assert.Equal(t, "https://issuer.example.com", parsed.Issuer())
+		assert.Equal(t, []string{"api"}, parsed.Audience())
+		assert.NotEmpty(t, parsed.JwtID())
+
+		other, err := ts.SignToken(map[string]interface{}{"sub": "john-doe"})
+		require.NoError(t, err)
+		otherParsed, err := jwt.Parse(other, jwt.WithVerify(false))
+		require.NoError(t, err)
+		assert.NotEqual(t, parsed.JwtID(), otherParsed.JwtID())
+	})
+
+	t.Run("keeps the claims provided in the payload", func(t *testing.T) {
+		t.Parallel()
+
+		claims := config.Claims{Issuer: "default", Audience: []string{"default"}, TTL: time.Hour, JTI: true}
+		ts, _ := token.New([]jwk.Key{makeKey(t, jwa.ES256, "ec")}, &config.JWK{Claims: claims})
+
+		payload := map[string]interface{}{
+			"iss": "custom",
+			"aud": "custom",
+			"iat": 1700000000,
+			"jti": "custom",
+		}
+		signed, err := ts.SignToken(payload)
+		require.NoError(t, err)
+
+		parsed, err := jwt.Parse(signed, jwt.WithVerify(false), jwt.WithValidate(false))
+		require.NoError(t, err)
+		assert.Equal(t, "custom", parsed.Issuer())
+		assert.Equal(t, []string{"custom"}, parsed.Audience())
+		assert.Equal(t, "custom", parsed.JwtID())
+		assert.Equal(t, int64(1700000000), parsed.IssuedAt().Unix())
+		assert.Equal(t, int64(1700003600), parsed.Expiration().Unix())
+		assert.Equal(t, int64(1700000000), parsed.NotBefore().Unix())
+	})
+
+	t.Run("does not set an expiration time if the TTL is zero", func(t *testing.T) {
+		t.Parallel()
+
+		ts, _ := token.New([]jwk.Key{makeKey(t, jwa.ES256, "ec")}, &config.JWK{})
+
+		signed, err := ts.SignToken(map[string]interface{}{"sub": "john-doe"})
+		require.NoError(t, err)
+
+		parsed, err := jwt.Parse(signed, jwt.WithVerify(false))
+		require.NoError(t, err)
+		assert.True(t, parsed.Expiration().IsZero())
+		assert.Empty(t, parsed.JwtID())
+		assert.False(t, parsed.IssuedAt().IsZero())
+	})
+
+	t.Run("overrides the token lifetime", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := &config.JWK{Claims: config.Claims{TTL: time.Hour}}
+		ts, _ := token.New([]jwk.Key{makeKey(t, jwa.ES256, "ec")}, cfg)
+
+		signed, err := ts.SignToken(map[string]interface{}{"sub": "john-doe"}, token.WithTTL(time.Minute))
+		require.NoError(t, err)
+
+		parsed, err := jwt.Parse(signed, jwt.WithVerify(false))
+		require.NoError(t, err)
+		assert.Equal(t, parsed.IssuedAt().Add(time.Minute), parsed.Expiration())
+	})
+
+	t.Run("adds the provided protected headers", func(t *testing.T) {
+		t.Parallel()
+
+		ts, _ := token.New([]jwk.Key{makeKey(t, jwa.ES256, "ec")}, &config.JWK{})
+
+		headers := map[string]interface{}{"typ": "at+jwt", "cty": "JWT", "jku": "https://example.com/jwks.json", "custom": "value"}
+		signed, err := ts.SignToken(map[string]interface{}{"sub": "john-doe"}, token.WithHeaders(headers))
+		require.NoError(t, err)
+
+		msg, err := jws.Parse(signed)
+		require.NoError(t, err)
+		protected := msg.Signatures()[0].ProtectedHeaders()
+		assert.Equal(t, "at+jwt", protected.Type())
+		assert.Equal(t, "JWT", protected.ContentType())
+		assert.Equal(t, "https://example.com/jwks.json", protected.JWKSetURL())
+		assert.Equal(t, jwa.ES256, protected.Algorithm())
+		assert.Equal(t, "ec", protected.KeyID())
+		custom, _ := protected.Get("custom")
+		assert.Equal(t, "value", custom)
+	})
+
+	t.Run("selects the signing key from the header", func(t *testing.T) {
+		t.Parallel()
+
+		keys := []jwk.Key{makeKey(t, jwa.RS256, "rsa"), makeKey(t, jwa.ES256, "ec")}
+		ts, _ := token.New(keys, &config.JWK{})
+
+		for _, headers := range []map[string]interface{}{{"kid": "ec"}, {"alg": "ES256"}} {
+			signed, err := ts.SignToken(map[string]interface{}{"sub": "john-doe"}, token.WithHeaders(headers))
+			require.NoError(t, err)
+
+			msg, err := jws.Parse(signed)
+			require.NoError(t, err)
+			assert.Equal(t, "ec", msg.Signatures()[0].ProtectedHeaders().KeyID())
+		}
+	})
+
+	t.Run("returns an error if the header conflicts with the key", func(t *testing.T) {
+		t.Parallel()
+
+		keys := []jwk.Key{makeKey(t, jwa.RS256, "rsa"), makeKey(t, jwa.ES256, "ec")}
+		ts, _ := token.New(keys, &config.JWK{})
+
+		headers := []map[string]interface{}{{"alg": "RS256"}, {"kid": "rsa"}, {"alg": 1}}
+		for _, h := range headers {
+			signed, err := ts.SignToken(map[string]interface{}{}, token.WithKeyID("ec"), token.WithHeaders(h))
+			assert.Nil(t, signed)
+			require.ErrorIs(t, err, token.ErrHeaderConflict)
+		}
+	})
+
 	t.Run("returns an error if the payload is invalid", func(t *testing.T) {
 		t.Parallel()
 
@@ -172,3 +615,131 @@ func TestSignToken(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+func TestAddKey(t *testing.T) {
+	t.Parallel()
+
+	t.Run("publishes the key without changing the default key", func(t *testing.T) {
+		t.Parallel()
+
+		ts, _ := token.New([]jwk.Key{makeKey(t, jwa.RS256, "rsa")}, &config.JWK{})
+		require.NoError(t, ts.AddKey(makeKey(t, jwa.ES256, "ec")))
+
+		set, _ := ts.GetKeySet()
+		assert.Equal(t, 2, set.Len())
+		assert.Equal(t, "rsa", ts.GetKey().KeyID())
+	})
+
+	t.Run("returns an error if the key ID is already in use", func(t *testing.T) {
+		t.Parallel()
+
+		ts, _ := token.New([]jwk.Key{makeKey(t, jwa.RS256, "rsa")}, &config.JWK{})
+		err := ts.AddKey(makeKey(t, jwa.ES256, "rsa"))
+
+		require.ErrorIs(t, err, token.ErrDuplicateKeyID)
+		assert.Len(t, ts.GetKeys(), 1)
+	})
+}
+
+func TestRemoveKey(t *testing.T) {
+	t.Parallel()
+
+	t.Run("removes the key from the key set", func(t *testing.T) {
+		t.Parallel()
+
+		keys := []jwk.Key{makeKey(t, jwa.RS256, "rsa"), makeKey(t, jwa.ES256, "ec")}
+		ts, _ := token.New(keys, &config.JWK{})
+		require.NoError(t, ts.RemoveKey("ec"))
+
+		set, _ := ts.GetKeySet()
+		assert.Equal(t, 1, set.Len())
+
+		_, err := ts.FindKey("ec", "")
+		require.ErrorIs(t, err, token.ErrKeyNotFound)
+	})
+
+	t.Run("returns an error if the key is the default key", func(t *testing.T) {
+		t.Parallel()
+
+		ts, _ := token.New([]jwk.Key{makeKey(t, jwa.RS256, "rsa")}, &config.JWK{})
+		err := ts.RemoveKey("rsa")
+
+		require.ErrorIs(t, err, token.ErrDefaultKey)
+		assert.EqualError(t, err, "cannot remove the default key: rsa")
+	})
+
+	t.Run("returns an error if the key does not exist", func(t *testing.T) {
+		t.Parallel()
+
+		ts, _ := token.New([]jwk.Key{makeKey(t, jwa.RS256, "rsa")}, &config.JWK{})
+		err := ts.RemoveKey("missing")
+
+		require.ErrorIs(t, err, token.ErrKeyNotFound)
+	})
+}
+
+func TestReplaceKey(t *testing.T) {
+	t.Parallel()
+
+	t.Run("replaces the key with the same key ID", func(t *testing.T) {
+		t.Parallel()
+
+		keys := []jwk.Key{makeKey(t, jwa.RS256, "rsa"), makeKey(t, jwa.ES256, "ec")}
+		ts, _ := token.New(keys, &config.JWK{})
+
+		replacement := makeKey(t, jwa.ES384, "ec")
+		require.NoError(t, ts.ReplaceKey(replacement))
+
+		key, err := ts.FindKey("ec", "")
+		require.NoError(t, err)
+		assert.Equal(t, replacement, key)
+		assert.Len(t, ts.GetKeys(), 2)
+	})
+
+	t.Run("replaces the default key", func(t *testing.T) {
+		t.Parallel()
+
+		ts, _ := token.New([]jwk.Key{makeKey(t, jwa.RS256, "rsa")}, &config.JWK{})
+
+		replacement := makeKey(t, jwa.RS256, "rsa")
+		require.NoError(t, ts.ReplaceKey(replacement))
+		assert.Equal(t, replacement, ts.GetKey())
+	})
+
+	t.Run("returns an error if the key does not exist", func(t *testing.T) {
+		t.Parallel()
+
+		ts, _ := token.New([]jwk.Key{makeKey(t, jwa.RS256, "rsa")}, &config.JWK{})
+		err := ts.ReplaceKey(makeKey(t, jwa.RS256, "missing"))
+
+		require.ErrorIs(t, err, token.ErrKeyNotFound)
+	})
+}
+
+func TestSetDefaultKey(t *testing.T) {
+	t.Parallel()
+
+	t.Run("changes the signing key", func(t *testing.T) {
+		t.Parallel()
+
+		keys := []jwk.Key{makeKey(t, jwa.RS256, "rsa"), makeKey(t, jwa.ES256, "ec")}
+		ts, _ := token.New(keys, &config.JWK{})
+		require.NoError(t, ts.SetDefaultKey("ec"))
+
+		signed, err := ts.SignToken(map[string]interface{}{"sub": "john-doe"})
+		require.NoError(t, err)
+
+		msg, _ := jws.Parse(signed)
+		assert.Equal(t, "ec", msg.Signatures()[0].ProtectedHeaders().KeyID())
+	})
+
+	t.Run("returns an error if the key does not exist", func(t *testing.T) {
+		t.Parallel()
+
+		ts, _ := token.New([]jwk.Key{makeKey(t, jwa.RS256, "rsa")}, &config.JWK{})
+		err := ts.SetDefaultKey("missing")
+
+		require.ErrorIs(t, err, token.ErrKeyNotFound)
+		assert.Equal(t, "rsa", ts.GetKey().KeyID())
+	})
+}
@@ -0,0 +1,171 @@
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+// ErrTokenRevoked is reported when the token ID is in the revocation list.
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// VerifyOption customizes the claims validated by VerifyToken.
+type VerifyOption func(*verifyOptions)
+
+type verifyOptions struct {
+	skew        time.Duration
+	issuer      string
+	audience    string
+	revocations RevocationList
+}
+
+// RevocationList reports whether a token has been revoked by its ID.
+type RevocationList interface {
+	IsRevoked(jti string) bool
+}
+
+// WithSkew tolerates the provided clock skew when validating the exp, nbf and
+// iat claims.
+func WithSkew(skew time.Duration) VerifyOption {
+	return func(o *verifyOptions) {
+		o.skew = skew
+	}
+}
+
+// WithIssuer requires the iss claim to match the provided issuer.
+func WithIssuer(issuer string) VerifyOption {
+	return func(o *verifyOptions) {
+		o.issuer = issuer
+	}
+}
+
+// WithAudience requires the aud claim to contain the provided audience.
+func WithAudience(audience string) VerifyOption {
+	return func(o *verifyOptions) {
+		o.audience = audience
+	}
+}
+
+// WithRevocationList rejects tokens whose jti claim is in the list.
+func WithRevocationList(revocations RevocationList) VerifyOption {
+	return func(o *verifyOptions) {
+		o.revocations = revocations
+	}
+}
+
+// Verification is the result of verifying a token. The header and claims are
+// decoded even if the token is invalid, as long as it is well formed.
+type Verification struct {
+	Valid    bool                   `json:"valid"`
+	Header   map[string]interface{} `json:"header,omitempty"`
+	Claims   map[string]interface{} `json:"claims,omitempty"`
+	Failures []VerificationFailure  `json:"failures,omitempty"`
+}
+
+// VerificationFailure describes a failed check. Check is one of format,
+// signature, exp, nbf, iat, iss, aud or revoked.
+type VerificationFailure struct {
+	Check string `json:"check"`
+	Error string `json:"error"`
+}
+
+func (v *Verification) fail(check string, err error) {
+	v.Valid = false
+	v.Failures = append(v.Failures, VerificationFailure{Check: check, Error: err.Error()})
+}
+
+// VerifyToken checks the signature of a compact JWT against the keys of the
+// service and validates its registered claims. Every check is performed so
+// that all failures are reported.
+func (s *service) VerifyToken(signed []byte, opts ...VerifyOption) *Verification {
+	var o verifyOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	v := &Verification{Valid: true}
+
+	msg, err := jws.Parse(signed, jws.WithCompact())
+	if err != nil {
+		v.fail("format", err)
+		return v
+	}
+
+	if err = json.Unmarshal(msg.Payload(), &v.Claims); err != nil {
+		v.fail("format", err)
+		return v
+	}
+
+	header := msg.Signatures()[0].ProtectedHeaders()
+	if v.Header, err = header.AsMap(context.Background()); err != nil {
+		v.fail("format", err)
+		return v
+	}
+
+	if err = s.verifySignature(signed, header); err != nil {
+		v.fail("signature", err)
+	}
+
+	t, err := jwt.Parse(signed, jwt.WithVerify(false), jwt.WithValidate(false))
+	if err != nil {
+		v.fail("format", err)
+		return v
+	}
+
+	for _, check := range claimChecks(&o) {
+		err = jwt.Validate(t, jwt.WithResetValidators(true), jwt.WithAcceptableSkew(o.skew), check.opt)
+		if err != nil {
+			v.fail(check.name, err)
+		}
+	}
+
+	if o.revocations != nil && t.JwtID() != "" && o.revocations.IsRevoked(t.JwtID()) {
+		v.fail("revoked", ErrTokenRevoked)
+	}
+
+	return v
+}
+
+// verifySignature verifies the token with the key matching the kid and alg
+// headers, so that a token cannot select an algorithm other than the one of
+// the key.
+func (s *service) verifySignature(signed []byte, header jws.Headers) error {
+	alg := header.Algorithm()
+
+	key, err := s.FindKey(header.KeyID(), alg)
+	if err != nil {
+		return err
+	}
+
+	if _, err = jws.Verify(signed, jws.WithKey(alg, key)); err != nil {
+		return err //nolint:wrapcheck // The error is reported as is.
+	}
+
+	return nil
+}
+
+type claimCheck struct {
+	name string
+	opt  jwt.ValidateOption
+}
+
+func claimChecks(o *verifyOptions) []claimCheck {
+	checks := []claimCheck{
+		{jwt.ExpirationKey, jwt.WithValidator(jwt.IsExpirationValid())},
+		{jwt.NotBeforeKey, jwt.WithValidator(jwt.IsNbfValid())},
+		{jwt.IssuedAtKey, jwt.WithValidator(jwt.IsIssuedAtValid())},
+	}
+
+	if o.issuer != "" {
+		checks = append(checks, claimCheck{jwt.IssuerKey, jwt.WithIssuer(o.issuer)})
+	}
+	if o.audience != "" {
+		checks = append(checks, claimCheck{jwt.AudienceKey, jwt.WithAudience(o.audience)})
+	}
+
+	return checks
+}
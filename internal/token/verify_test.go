@@ -0,0 +1,134 @@
+package token_test
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/murar8/local-jwks-server/internal/config"
+	"github.com/murar8/local-jwks-server/internal/revocation"
+	"github.com/murar8/local-jwks-server/internal/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func failedChecks(v *token.Verification) []string {
+	checks := make([]string, 0, len(v.Failures))
+	for _, f := range v.Failures {
+		checks = append(checks, f.Check)
+	}
+	return checks
+}
+
+func TestVerifyToken(t *testing.T) {
+	t.Parallel()
+
+	makeService := func(t *testing.T) token.Service {
+		t.Helper()
+
+		keys := []jwk.Key{makeKey(t, jwa.RS256, "rsa"), makeKey(t, jwa.HS256, "hmac")}
+		ts, err := token.New(keys, &config.JWK{Claims: config.Claims{TTL: time.Hour}})
+		require.NoError(t, err)
+		return ts
+	}
+
+	t.Run("accepts a token signed by the service", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeService(t)
+
+		for _, kid := range []string{"rsa", "hmac"} {
+			signed, err := ts.SignToken(map[string]interface{}{"sub": "john-doe", "iss": "issuer", "aud": "api"}, token.WithKeyID(kid))
+			require.NoError(t, err)
+
+			v := ts.VerifyToken(signed, token.WithIssuer("issuer"), token.WithAudience("api"))
+			assert.True(t, v.Valid)
+			assert.Empty(t, v.Failures)
+			assert.Equal(t, "john-doe", v.Claims["sub"])
+			assert.Equal(t, kid, v.Header["kid"])
+		}
+	})
+
+	t.Run("reports every failed claim", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeService(t)
+		now := time.Now().Unix()
+		payload := map[string]interface{}{
+			"iss": "other",
+			"aud": "other",
+			"exp": now - 60,
+			"nbf": now + 60,
+			"iat": now + 60,
+		}
+		signed, err := ts.SignToken(payload)
+		require.NoError(t, err)
+
+		v := ts.VerifyToken(signed, token.WithIssuer("issuer"), token.WithAudience("api"))
+		assert.False(t, v.Valid)
+		assert.Equal(t, []string{"exp", "nbf", "iat", "iss", "aud"}, failedChecks(v))
+		assert.Equal(t, "other", v.Claims["iss"])
+	})
+
+	t.Run("tolerates the configured skew", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeService(t)
+		signed, err := ts.SignToken(map[string]interface{}{"exp": time.Now().Unix() - 60})
+		require.NoError(t, err)
+
+		assert.False(t, ts.VerifyToken(signed).Valid)
+		assert.True(t, ts.VerifyToken(signed, token.WithSkew(2*time.Minute)).Valid)
+	})
+
+	t.Run("reports revoked tokens", func(t *testing.T) {
+		t.Parallel()
+
+		ts := makeService(t)
+		signed, err := ts.SignToken(map[string]interface{}{"jti": "token-id"})
+		require.NoError(t, err)
+
+		revocations := revocation.New()
+		assert.True(t, ts.VerifyToken(signed, token.WithRevocationList(revocations)).Valid)
+
+		revocations.Revoke("token-id", time.Time{})
+		v := ts.VerifyToken(signed, token.WithRevocationList(revocations))
+		assert.False(t, v.Valid)
+		assert.Equal(t, []string{"revoked"}, failedChecks(v))
+	})
+
+	t.Run("reports tokens signed by unknown keys", func(t *testing.T) {
+		t.Parallel()
+
+		other := makeService(t)
+		signed, err := other.SignToken(map[string]interface{}{"sub": "john-doe"})
+		require.NoError(t, err)
+
+		v := makeService(t).VerifyToken(signed)
+		assert.False(t, v.Valid)
+		assert.Equal(t, []string{"signature"}, failedChecks(v))
+		assert.Equal(t, "john-doe", v.Claims["sub"])
+	})
+
+	t.Run("rejects unsigned tokens", func(t *testing.T) {
+		t.Parallel()
+
+		header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"rsa"}`))
+		payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"john-doe"}`))
+
+		v := makeService(t).VerifyToken([]byte(header + "." + payload + "."))
+		assert.False(t, v.Valid)
+		assert.Equal(t, []string{"signature"}, failedChecks(v))
+	})
+
+	t.Run("reports malformed tokens", func(t *testing.T) {
+		t.Parallel()
+
+		v := makeService(t).VerifyToken([]byte("not-a-token"))
+		assert.False(t, v.Valid)
+		assert.Equal(t, []string{"format"}, failedChecks(v))
+		assert.Nil(t, v.Claims)
+	})
+}